@@ -0,0 +1,322 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"launchpad.net/gnuflag"
+)
+
+const aliasesCommandName = "aliases"
+
+// newAliasesCommand returns the "aliases" command, whose subcommands
+// manage the user aliases of super.
+func newAliasesCommand(super *SuperCommand) *SuperCommand {
+	c := NewSuperCommand(SuperCommandParams{
+		Name:        aliasesCommandName,
+		UsagePrefix: super.Name,
+		Purpose:     "manage command aliases",
+		Doc: fmt.Sprintf(`
+Aliases are shortcuts for longer %s command lines. They are kept in
+%s, which may also be edited by hand.
+`, super.Name, super.userAliasesFilename),
+		FlagEnvPrefix: super.flagEnvPrefix,
+	})
+	c.Register(&listAliasesCommand{super: super})
+	c.Register(&addAliasCommand{super: super})
+	c.Register(&removeAliasCommand{super: super})
+	return c
+}
+
+// aliasDetails holds the details of an alias written by "aliases list".
+type aliasDetails struct {
+	Name        string `json:"name" yaml:"name" tabular:"ALIAS"`
+	Command     string `json:"command" yaml:"command" tabular:"COMMAND"`
+	Description string `json:"description,omitempty" yaml:"description,omitempty" tabular:"DESCRIPTION"`
+}
+
+// listAliasesCommand lists the user aliases.
+type listAliasesCommand struct {
+	CommandBase
+	super *SuperCommand
+	out   Output
+}
+
+func (c *listAliasesCommand) Info() *Info {
+	return &Info{
+		Name:    "list",
+		Purpose: "list command aliases",
+		Doc: `
+Aliases are listed in the order they appear in the alias file. Lines that
+cannot be read, and aliases for commands that do not exist, are reported
+as warnings.
+`,
+	}
+}
+
+func (c *listAliasesCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.out.AddFlags(f, "tabular", DefaultFormatters)
+}
+
+func (c *listAliasesCommand) Run(ctx *Context) error {
+	aliases, errs := readAliasFile(c.super.userAliasesFilename)
+	for _, err := range errs {
+		ctx.Infof("WARNING: %v", err)
+	}
+	sorted := make([]Alias, 0, len(aliases))
+	for _, alias := range aliases {
+		sorted = append(sorted, alias)
+	}
+	sort.Sort(aliasesByLine(sorted))
+	details := make([]aliasDetails, len(sorted))
+	for i, alias := range sorted {
+		if target := c.super.aliasTarget(alias.Name); c.super.subcmds[target].command == nil {
+			ctx.Infof("WARNING: alias %q refers to unknown command %q", alias.Name, target)
+		}
+		details[i] = aliasDetails{
+			Name:        alias.Name,
+			Command:     alias.value(),
+			Description: alias.Description,
+		}
+	}
+	return c.out.Write(ctx, details)
+}
+
+// aliasesByLine sorts aliases by the line they are defined on.
+type aliasesByLine []Alias
+
+func (a aliasesByLine) Len() int           { return len(a) }
+func (a aliasesByLine) Less(i, j int) bool { return a[i].Line < a[j].Line }
+func (a aliasesByLine) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// addAliasCommand adds a user alias.
+type addAliasCommand struct {
+	CommandBase
+	super   *SuperCommand
+	purpose string
+	name    string
+	args    []string
+}
+
+func (c *addAliasCommand) Info() *Info {
+	return &Info{
+		Name:    "add",
+		Args:    "<name> <command> [<arg>...]",
+		Purpose: "add a command alias",
+		Doc: `
+The alias runs the given command, which must exist or be another alias,
+with the given arguments, followed by any arguments given to the alias.
+In aliases added to a new alias file, or to one in version 2 format, "$1"
+to "$9" and "$@" are replaced with the arguments given to the alias
+instead; quote them to stop the shell from expanding them.
+`,
+	}
+}
+
+func (c *addAliasCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&c.purpose, "purpose", "", "Describe the alias in the list of commands")
+}
+
+// AllowInterspersedFlags returns false, so that the arguments of the
+// aliased command are not taken to be flags of "aliases add".
+func (c *addAliasCommand) AllowInterspersedFlags() bool {
+	return false
+}
+
+func (c *addAliasCommand) Init(args []string) error {
+	switch len(args) {
+	case 0:
+		return fmt.Errorf("no alias name specified")
+	case 1:
+		return fmt.Errorf("no command specified")
+	}
+	c.name, c.args = args[0], args[1:]
+	return nil
+}
+
+func (c *addAliasCommand) Run(ctx *Context) error {
+	if target := c.super.aliasTarget(c.args[0]); c.super.subcmds[target].command == nil {
+		return &UnrecognizedCommand{
+			Name:        c.super.Name + " " + target,
+			Suggestions: suggest(target, c.super.commandNames()),
+		}
+	}
+	file, err := loadAliasFile(c.super.userAliasesFilename)
+	if err != nil {
+		return err
+	}
+	if err := file.add(c.name, c.args, c.purpose); err != nil {
+		return err
+	}
+	if err := c.super.saveAliasFile(file); err != nil {
+		return err
+	}
+	ctx.Infof("added alias %q", c.name)
+	return nil
+}
+
+// removeAliasCommand removes a user alias.
+type removeAliasCommand struct {
+	CommandBase
+	super *SuperCommand
+	name  string
+}
+
+func (c *removeAliasCommand) Info() *Info {
+	return &Info{
+		Name:    "remove",
+		Args:    "<name>",
+		Purpose: "remove a command alias",
+		Doc: `
+The alias is removed from the alias file along with the comments that
+describe it. Other lines of the file are left as they are.
+`,
+	}
+}
+
+func (c *removeAliasCommand) Init(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("no alias name specified")
+	}
+	c.name = args[0]
+	return CheckEmpty(args[1:])
+}
+
+func (c *removeAliasCommand) Run(ctx *Context) error {
+	file, err := loadAliasFile(c.super.userAliasesFilename)
+	if err != nil {
+		return err
+	}
+	if err := file.remove(c.name); err != nil {
+		return err
+	}
+	if err := c.super.saveAliasFile(file); err != nil {
+		return err
+	}
+	ctx.Infof("removed alias %q", c.name)
+	return nil
+}
+
+// aliasFile holds the lines of an alias file while it is edited, so
+// that the comments and ordering of the file are kept when it is
+// written.
+type aliasFile struct {
+	filename string
+	lines    []string
+	version  int
+	aliases  map[string]Alias
+}
+
+// loadAliasFile reads the alias file with the given name for editing. A
+// missing file is treated as an empty file in version 2 format.
+func loadAliasFile(filename string) (*aliasFile, error) {
+	content, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return &aliasFile{
+			filename: filename,
+			lines:    []string{"# alias-format: 2"},
+			version:  2,
+			aliases:  map[string]Alias{},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	aliases, _ := parseAliases(filename, string(content))
+	return &aliasFile{
+		filename: filename,
+		lines:    lines,
+		version:  aliasFileVersion(lines),
+		aliases:  aliases,
+	}, nil
+}
+
+// add appends an alias to the file, preceded by its description if it
+// has one.
+func (f *aliasFile) add(name string, args []string, description string) error {
+	if !validAliasName(name) {
+		return fmt.Errorf("invalid alias name %q", name)
+	}
+	if _, found := f.aliases[name]; found {
+		return fmt.Errorf("alias %q already exists", name)
+	}
+	value, err := formatAliasValue(aliasArgs(args, f.version), f.version)
+	if err != nil {
+		return err
+	}
+	line := name + " = " + value
+	if f.version >= 2 {
+		// Check that the alias can be read back.
+		if _, errs := parseAliases(f.filename, "# alias-format: 2\n"+line); len(errs) > 0 {
+			return fmt.Errorf("cannot add alias %q: %s", name, errs[0].(*AliasFileError).Message)
+		}
+	}
+	// A comment at the end of the file would otherwise describe the
+	// new alias.
+	if last := len(f.lines) - 1; last > 0 && strings.HasPrefix(strings.TrimSpace(f.lines[last]), "#") {
+		f.lines = append(f.lines, "")
+	}
+	if description = strings.TrimSpace(description); description != "" {
+		for _, text := range strings.Split(description, "\n") {
+			f.lines = append(f.lines, strings.TrimSpace("# "+text))
+		}
+	}
+	f.lines = append(f.lines, line)
+	return nil
+}
+
+// remove removes the lines defining the named alias from the file. In
+// version 2 files, the comments describing the alias are removed too.
+func (f *aliasFile) remove(name string) error {
+	if _, found := f.aliases[name]; !found {
+		return fmt.Errorf("alias %q not found", name)
+	}
+	var lines []string
+	for i, line := range f.lines {
+		line = strings.TrimSpace(line)
+		parts := strings.SplitN(line, "=", 2)
+		if strings.HasPrefix(line, "#") || len(parts) != 2 || strings.TrimSpace(parts[0]) != name {
+			lines = append(lines, f.lines[i])
+			continue
+		}
+		if f.version < 2 {
+			continue
+		}
+		// The first line holds the format version, not a description.
+		for len(lines) > 1 && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), "#") {
+			lines = lines[:len(lines)-1]
+		}
+	}
+	f.lines = lines
+	return nil
+}
+
+// saveAliasFile replaces c's alias file with file, and reloads c's
+// aliases from it.
+func (c *SuperCommand) saveAliasFile(file *aliasFile) (err error) {
+	if err := os.MkdirAll(filepath.Dir(file.filename), 0755); err != nil {
+		return err
+	}
+	out, err := (&Output{}).openFile(file.filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.close(err == nil); err == nil {
+			err = closeErr
+		}
+	}()
+	if _, err = out.WriteString(strings.Join(file.lines, "\n") + "\n"); err != nil {
+		return err
+	}
+	c.userAliases, _ = parseAliases(file.filename, strings.Join(file.lines, "\n"))
+	return nil
+}
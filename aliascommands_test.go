@@ -0,0 +1,201 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type AliasCommandsSuite struct {
+	gitjujutesting.IsolationSuite
+	filename string
+}
+
+var _ = gc.Suite(&AliasCommandsSuite{})
+
+func (s *AliasCommandsSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.filename = filepath.Join(c.MkDir(), "aliases")
+}
+
+func (s *AliasCommandsSuite) writeAliases(c *gc.C, content string) {
+	err := ioutil.WriteFile(s.filename, []byte(content), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *AliasCommandsSuite) readAliases(c *gc.C) string {
+	content, err := ioutil.ReadFile(s.filename)
+	c.Assert(err, jc.ErrorIsNil)
+	return string(content)
+}
+
+func (s *AliasCommandsSuite) run(c *gc.C, args ...string) (*cmd.Context, error) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:                "jujutest",
+		UserAliasesFilename: s.filename,
+	})
+	super.Register(&TestCommand{Name: "defenestrate"})
+	return cmdtesting.RunCommand(c, super, append([]string{"aliases"}, args...)...)
+}
+
+// checkRunError checks that err was returned by the subcommand of a
+// SuperCommand, which logs the error before silencing it.
+func checkRunError(c *gc.C, err error, message string) {
+	c.Check(cmd.IsErrSilent(err), jc.IsTrue)
+	c.Check(c.GetTestLog(), jc.Contains, "ERROR cmd "+message+"\n")
+}
+
+func (s *AliasCommandsSuite) TestNotRegistered(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	_, err := cmdtesting.RunCommand(c, super, "aliases", "list")
+	c.Assert(err, gc.ErrorMatches, "unrecognized command: jujutest aliases")
+}
+
+func (s *AliasCommandsSuite) TestList(c *gc.C) {
+	s.writeAliases(c, `# alias-format: 2
+
+# Defenestrate firmly.
+firm = defenestrate --option 'very firmly' $1
+soft = defenestrate --option softly
+bad = defenestrate 'unterminated
+typo = defenstrate
+`)
+	ctx, err := s.run(c, "list")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+ALIAS  COMMAND                                 DESCRIPTION
+firm   defenestrate --option 'very firmly' $1  Defenestrate firmly.
+soft   defenestrate --option softly
+typo   defenstrate
+`[1:])
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, ""+
+		"WARNING: "+s.filename+":6: unterminated single quote\n"+
+		"WARNING: alias \"typo\" refers to unknown command \"defenstrate\"\n")
+
+	ctx, err = s.run(c, "list", "--format", "json")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), jc.HasPrefix, `[{"name":"firm","command":"defenestrate --option 'very firmly' $1","description":"Defenestrate firmly."},`)
+}
+
+func (s *AliasCommandsSuite) TestAddToNewFile(c *gc.C) {
+	s.filename = filepath.Join(c.MkDir(), "juju", "aliases")
+	ctx, err := s.run(c, "add", "--purpose", "Defenestrate firmly.", "firm", "defenestrate", "--option", "very firmly", "$1", "$HOME")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "added alias \"firm\"\n")
+	c.Check(s.readAliases(c), gc.Equals, `# alias-format: 2
+# Defenestrate firmly.
+firm = defenestrate --option 'very firmly' $1 '$HOME'
+`)
+
+	aliases, err := cmd.ReadAliasFile(s.filename)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(aliases["firm"].Description, gc.Equals, "Defenestrate firmly.")
+	c.Check(aliases["firm"].Args, jc.DeepEquals, []string{"defenestrate", "--option", "very firmly", "$1", "$$HOME"})
+}
+
+func (s *AliasCommandsSuite) TestAddPreservesFile(c *gc.C) {
+	s.writeAliases(c, `
+# my aliases
+def = defenestrate
+# trailing comment`)
+	_, err := s.run(c, "add", "soft", "defenestrate", "--option", "softly")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.readAliases(c), gc.Equals, `
+# my aliases
+def = defenestrate
+# trailing comment
+
+soft = defenestrate --option softly
+`)
+
+	_, err = s.run(c, "add", "spaced", "defenestrate", "--option", "very softly")
+	checkRunError(c, err, `argument "very softly" cannot be written to a version 1 alias file`)
+}
+
+func (s *AliasCommandsSuite) TestAddErrors(c *gc.C) {
+	s.writeAliases(c, "# alias-format: 2\ndef = defenestrate\n")
+	for i, test := range []struct {
+		args   []string
+		err    string
+		logged bool
+	}{{
+		args: []string{},
+		err:  "no alias name specified",
+	}, {
+		args: []string{"name"},
+		err:  "no command specified",
+	}, {
+		args:   []string{"name", "defenstrate"},
+		err:    `unrecognized command: jujutest defenstrate (did you mean "defenestrate"?)`,
+		logged: true,
+	}, {
+		args:   []string{"def", "defenestrate"},
+		err:    `alias "def" already exists`,
+		logged: true,
+	}, {
+		args: []string{"-n", "defenestrate"},
+		err:  `flag provided but not defined: -n`,
+	}, {
+		args:   []string{"a$b", "defenestrate"},
+		err:    `invalid alias name "a$b"`,
+		logged: true,
+	}, {
+		args:   []string{"name", "defenestrate", "--option=$@"},
+		err:    `cannot add alias "name": $@ must be a separate argument`,
+		logged: true,
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		_, err := s.run(c, append([]string{"add"}, test.args...)...)
+		if test.logged {
+			checkRunError(c, err, test.err)
+		} else {
+			c.Check(err, gc.ErrorMatches, test.err)
+		}
+	}
+	c.Check(s.readAliases(c), gc.Equals, "# alias-format: 2\ndef = defenestrate\n")
+}
+
+func (s *AliasCommandsSuite) TestRemove(c *gc.C) {
+	s.writeAliases(c, `# alias-format: 2
+# Aliases for defenestration.
+
+# Defenestrate firmly.
+firm = defenestrate --option firmly
+# Defenestrate softly.
+soft = defenestrate --option softly
+`)
+	ctx, err := s.run(c, "remove", "firm")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "removed alias \"firm\"\n")
+	c.Check(s.readAliases(c), gc.Equals, `# alias-format: 2
+# Aliases for defenestration.
+
+# Defenestrate softly.
+soft = defenestrate --option softly
+`)
+
+	_, err = s.run(c, "remove", "firm")
+	checkRunError(c, err, `alias "firm" not found`)
+	_, err = s.run(c, "remove")
+	c.Assert(err, gc.ErrorMatches, "no alias name specified")
+}
+
+func (s *AliasCommandsSuite) TestRemoveVersion1(c *gc.C) {
+	s.writeAliases(c, `# comments are kept
+repeat = defenestrate
+def = defenestrate
+repeat = defenestrate --option again
+`)
+	_, err := s.run(c, "remove", "repeat")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.readAliases(c), gc.Equals, "# comments are kept\ndef = defenestrate\n")
+}
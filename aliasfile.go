@@ -4,50 +4,468 @@
 package cmd
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
+	"os"
+	"regexp"
 	"strings"
 )
 
-// ParseAliasFile will read the specified file and convert
+// aliasFormat2 marks an alias file as being in version 2 format when it
+// is the first line of the file.
+var aliasFormat2 = regexp.MustCompile(`^#\s*alias-format:\s*2\s*$`)
+
+// Alias is an alias read from an alias file.
+//
+// Lines in an alias file have the form "name = cmd [args...]", and lines
+// starting with "#" are comments. In the original format the arguments
+// are separated by white space. A file whose first line is
+// "# alias-format: 2" uses version 2 of the format, in which the
+// arguments are split as a shell would split them, honouring single and
+// double quotes and backslash escapes, and may refer to the arguments
+// given to the alias: $1 to $9 are replaced with the corresponding
+// argument and $@ with all of them. Without any such placeholder, the
+// arguments given to an alias are appended to it. Comment lines
+// immediately before an alias describe it in "help commands". An alias
+// may run another alias, but an alias that runs a command of its own
+// name runs the command.
+type Alias struct {
+	Name string
+
+	// Args holds the command line that the alias runs. In version 2
+	// files, "$1" to "$9" and "$@" are placeholders, and "$$" is a
+	// literal "$".
+	Args []string
+
+	// Description holds the comment describing the alias, if any.
+	Description string
+
+	// Line holds the line number of the alias in its file.
+	Line int
+
+	// Version holds the version of the format of the alias's file.
+	Version int
+}
+
+// AliasFileError describes a line of an alias file that cannot be parsed.
+type AliasFileError struct {
+	Filename string
+	Line     int
+	Message  string
+}
+
+func (e *AliasFileError) Error() string {
+	return fmt.Sprintf("%s:%d: %s", e.Filename, e.Line, e.Message)
+}
+
+// AliasFileErrors describes each of the lines of an alias file that
+// cannot be parsed, in the order they appear in the file.
+type AliasFileErrors []*AliasFileError
+
+func (e AliasFileErrors) Error() string {
+	messages := make([]string, len(e))
+	for i, err := range e {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ParseAliasFile will read the specified file and convert
 // the content to a map of names to the command line arguments
 // they relate to.  The function will always return a valid map, even
-// if it is empty.
+// if it is empty. Lines that cannot be parsed are logged and skipped.
 func ParseAliasFile(aliasFilename string) map[string][]string {
 	result := map[string][]string{}
+	aliases, errs := readAliasFile(aliasFilename)
+	for _, err := range errs {
+		logger.Warningf("%v", err)
+	}
+	for name, alias := range aliases {
+		result[name] = alias.Args
+	}
+	return result
+}
+
+// ReadAliasFile reads the aliases in the specified file, keyed by name.
+// A missing file holds no aliases. If any lines cannot be parsed, the
+// aliases on the other lines are returned along with AliasFileErrors
+// describing those lines.
+func ReadAliasFile(aliasFilename string) (map[string]Alias, error) {
+	aliases, errs := readAliasFile(aliasFilename)
+	if len(errs) == 0 {
+		return aliases, nil
+	}
+	lineErrs := make(AliasFileErrors, len(errs))
+	for i, err := range errs {
+		lineErr, ok := err.(*AliasFileError)
+		if !ok {
+			// The file could not be read.
+			return aliases, err
+		}
+		lineErrs[i] = lineErr
+	}
+	return aliases, lineErrs
+}
+
+// readAliasFile reads the aliases in the specified file, returning an
+// error for each line that cannot be parsed.
+func readAliasFile(aliasFilename string) (map[string]Alias, []error) {
+	result := map[string]Alias{}
 	if aliasFilename == "" {
-		return result
+		return result, nil
 	}
 
 	content, err := ioutil.ReadFile(aliasFilename)
 	if err != nil {
-		logger.Tracef("unable to read alias file %q: %s", aliasFilename, err)
-		return result
+		if os.IsNotExist(err) {
+			logger.Tracef("unable to read alias file %q: %s", aliasFilename, err)
+			return result, nil
+		}
+		return result, []error{err}
 	}
+	return parseAliases(aliasFilename, string(content))
+}
 
-	lines := strings.Split(string(content), "\n")
+// parseAliases parses the content of an alias file, returning an error
+// for each line that cannot be parsed.
+func parseAliases(aliasFilename, content string) (map[string]Alias, []error) {
+	result := map[string]Alias{}
+	var errs []error
+	fail := func(line int, format string, args ...interface{}) {
+		errs = append(errs, &AliasFileError{
+			Filename: aliasFilename,
+			Line:     line,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+	lines := strings.Split(content, "\n")
+	version := aliasFileVersion(lines)
+	if version == 2 {
+		lines[0] = ""
+	}
+	var description []string
 	for i, line := range lines {
 		line = strings.TrimSpace(line)
-		if line == "" || strings.HasPrefix(line, "#") {
-			// skip blank lines and comments
+		if line == "" {
+			description = nil
+			continue
+		}
+		if strings.HasPrefix(line, "#") {
+			// Comments are skipped, but in version 2 they describe
+			// the alias that follows them.
+			description = append(description, strings.TrimSpace(line[1:]))
 			continue
 		}
+		alias := Alias{
+			Line:        i + 1,
+			Version:     version,
+			Description: strings.Join(description, " "),
+		}
+		description = nil
 		parts := strings.SplitN(line, "=", 2)
 		if len(parts) != 2 {
-			logger.Warningf("line %d bad in alias file: %s", i+1, line)
+			fail(alias.Line, "expected name = value: %s", line)
 			continue
 		}
 		name, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
 		if name == "" {
-			logger.Warningf("line %d missing alias name in alias file: %s", i+1, line)
+			fail(alias.Line, "missing alias name: %s", line)
 			continue
 		}
 		if value == "" {
-			logger.Warningf("line %d missing alias value in alias file: %s", i+1, line)
+			fail(alias.Line, "missing alias value: %s", line)
+			continue
+		}
+		alias.Name = name
+		if version == 1 {
+			alias.Description = ""
+			alias.Args = strings.Fields(value)
+		} else {
+			if !validAliasName(name) {
+				fail(alias.Line, "invalid alias name %q", name)
+				continue
+			}
+			if previous, found := result[name]; found {
+				fail(alias.Line, "alias %q already defined on line %d", name, previous.Line)
+				continue
+			}
+			args, err := splitAliasValue(value)
+			if err != nil {
+				fail(alias.Line, "%v", err)
+				continue
+			}
+			alias.Args = args
+			if len(alias.Args) == 0 {
+				fail(alias.Line, "missing alias value: %s", line)
+				continue
+			}
+			if strings.HasPrefix(alias.Args[0], "$") && !strings.HasPrefix(alias.Args[0], "$$") {
+				fail(alias.Line, "alias %q must start with a command, not a placeholder", name)
+				continue
+			}
+		}
+
+		logger.Tracef("setting alias %q=%q", name, alias.Args)
+		result[name] = alias
+	}
+	return result, errs
+}
+
+// aliasFileVersion returns the version of the format of an alias file
+// holding lines.
+func aliasFileVersion(lines []string) int {
+	if len(lines) > 0 && aliasFormat2.MatchString(strings.TrimSpace(lines[0])) {
+		return 2
+	}
+	return 1
+}
+
+// validAliasName reports whether name can be given to an alias in a
+// version 2 alias file.
+func validAliasName(name string) bool {
+	return name != "" && !strings.ContainsAny(name, " \t'\"\\$#=") && !strings.HasPrefix(name, "-")
+}
+
+// splitAliasValue splits the value of a version 2 alias into arguments.
+// Literal dollar signs are doubled, to distinguish them from
+// placeholders.
+func splitAliasValue(value string) ([]string, error) {
+	var args []string
+	var arg bytes.Buffer
+	inArg := false
+	// allArgs records whether the current argument holds $@.
+	allArgs := false
+	endArg := func() error {
+		if allArgs && arg.String() != "$@" {
+			return fmt.Errorf("$@ must be a separate argument")
+		}
+		if inArg {
+			args = append(args, arg.String())
+		}
+		arg.Reset()
+		inArg, allArgs = false, false
+		return nil
+	}
+	// placeholder writes the placeholder starting at value[i], which
+	// is a "$", and returns the index of its last character.
+	placeholder := func(i int) (int, error) {
+		if i+1 < len(value) {
+			switch c := value[i+1]; {
+			case c >= '1' && c <= '9':
+				arg.WriteString(value[i : i+2])
+				return i + 1, nil
+			case c == '@':
+				arg.WriteString("$@")
+				allArgs = true
+				return i + 1, nil
+			}
+		}
+		end := i + 1
+		for end < len(value) && isNameChar(value[end]) {
+			end++
+		}
+		return 0, fmt.Errorf("invalid placeholder %q (use $1 to $9 or $@, or \\$ for a literal $)", value[i:end])
+	}
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if err := endArg(); err != nil {
+				return nil, err
+			}
+		case c == '#' && !inArg:
+			// The rest of the line is a comment.
+			return args, endArg()
+		case c == '\'':
+			inArg = true
+			end := strings.IndexByte(value[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated single quote")
+			}
+			arg.WriteString(strings.Replace(value[i+1:i+1+end], "$", "$$", -1))
+			i += end + 1
+		case c == '"':
+			inArg = true
+			closed := false
+			for i++; i < len(value) && !closed; i++ {
+				switch c := value[i]; c {
+				case '"':
+					closed = true
+					i--
+				case '\\':
+					if i+1 < len(value) && strings.IndexByte("\"\\$", value[i+1]) >= 0 {
+						i++
+						if value[i] == '$' {
+							arg.WriteString("$$")
+						} else {
+							arg.WriteByte(value[i])
+						}
+					} else {
+						arg.WriteByte(c)
+					}
+				case '$':
+					var err error
+					if i, err = placeholder(i); err != nil {
+						return nil, err
+					}
+				default:
+					arg.WriteByte(c)
+				}
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated double quote")
+			}
+		case c == '\\':
+			inArg = true
+			if i+1 == len(value) {
+				return nil, fmt.Errorf("unfinished escape at end of line")
+			}
+			i++
+			if value[i] == '$' {
+				arg.WriteString("$$")
+			} else {
+				arg.WriteByte(value[i])
+			}
+		case c == '$':
+			inArg = true
+			var err error
+			if i, err = placeholder(i); err != nil {
+				return nil, err
+			}
+		default:
+			inArg = true
+			arg.WriteByte(c)
+		}
+	}
+	return args, endArg()
+}
+
+// expand returns the command line that the alias runs when it is given
+// args.
+func (a Alias) expand(args []string) ([]string, error) {
+	if a.Version < 2 {
+		return append(append([]string(nil), a.Args...), args...), nil
+	}
+	var result []string
+	used := false
+	for _, arg := range a.Args {
+		if arg == "$@" {
+			result = append(result, args...)
+			used = true
 			continue
 		}
+		var expanded bytes.Buffer
+		for i := 0; i < len(arg); i++ {
+			if arg[i] != '$' || i+1 == len(arg) {
+				expanded.WriteByte(arg[i])
+				continue
+			}
+			i++
+			if arg[i] == '$' {
+				expanded.WriteByte('$')
+				continue
+			}
+			n := int(arg[i] - '0')
+			if n > len(args) {
+				return nil, fmt.Errorf("alias %q needs at least %d argument(s), got %d", a.Name, n, len(args))
+			}
+			expanded.WriteString(args[n-1])
+			used = true
+		}
+		result = append(result, expanded.String())
+	}
+	if !used {
+		result = append(result, args...)
+	}
+	return result, nil
+}
+
+// value returns the command line that the alias runs as it is written in
+// an alias file.
+func (a Alias) value() string {
+	value, _ := formatAliasValue(a.Args, a.Version)
+	return value
+}
 
-		logger.Tracef("setting alias %q=%q", name, value)
-		result[name] = strings.Fields(value)
+// aliasArgs converts command line arguments into the Args of an alias
+// in a file of the given version. In version 2 files, "$1" to "$9" and
+// "$@" are placeholders and any other "$" is literal.
+func aliasArgs(args []string, version int) []string {
+	if version < 2 {
+		return args
+	}
+	result := make([]string, len(args))
+	for i, arg := range args {
+		var converted bytes.Buffer
+		for j := 0; j < len(arg); j++ {
+			converted.WriteByte(arg[j])
+			if arg[j] != '$' {
+				continue
+			}
+			if j+1 < len(arg) && (arg[j+1] >= '1' && arg[j+1] <= '9' || arg[j+1] == '@') {
+				converted.WriteByte(arg[j+1])
+				j++
+			} else {
+				converted.WriteByte('$')
+			}
+		}
+		result[i] = converted.String()
 	}
 	return result
 }
+
+// formatAliasValue returns args, the Args of an alias, as they are
+// written in an alias file of the given version.
+func formatAliasValue(args []string, version int) (string, error) {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if version >= 2 {
+			quoted[i] = quoteAliasArg(arg)
+			continue
+		}
+		if arg == "" || strings.ContainsAny(arg, " \t") {
+			return "", fmt.Errorf("argument %q cannot be written to a version 1 alias file", arg)
+		}
+		quoted[i] = arg
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// quoteAliasArg quotes arg, one of the Args of a version 2 alias, so
+// that splitAliasValue will return it unchanged.
+func quoteAliasArg(arg string) string {
+	var quoted, literal bytes.Buffer
+	flush := func() {
+		if literal.Len() == 0 {
+			return
+		}
+		text := literal.String()
+		literal.Reset()
+		for i := 0; i < len(text); i++ {
+			if !isNameChar(text[i]) && strings.IndexByte("./=:,+%@^~", text[i]) < 0 {
+				quoted.WriteString("'" + strings.Replace(text, "'", `'\''`, -1) + "'")
+				return
+			}
+		}
+		quoted.WriteString(text)
+	}
+	for i := 0; i < len(arg); i++ {
+		if arg[i] != '$' || i+1 == len(arg) {
+			literal.WriteByte(arg[i])
+			continue
+		}
+		i++
+		if arg[i] == '$' {
+			literal.WriteByte('$')
+			continue
+		}
+		flush()
+		quoted.WriteString(arg[i-1 : i+1])
+	}
+	flush()
+	if quoted.Len() == 0 {
+		return "''"
+	}
+	return quoted.String()
+}
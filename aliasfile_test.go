@@ -56,3 +56,122 @@ key =
 		"flags":  []string{"flags", "--with", "flag"},
 	})
 }
+
+func (*ParseAliasFileSuite) TestReadVersion2(c *gc.C) {
+	dir := c.MkDir()
+	filename := filepath.Join(dir, "aliases")
+	content := `# alias-format: 2
+
+# Deploy a charm to a machine.
+# Usage: to <charm> <machine>
+to = deploy $1 --to "$2"
+quoted = config --set 'name=a b' "path=\"c d\"" e\ f  # trailing comment
+all = run --all -- $@
+dollars = echo '$1' "\$2" \$@ cost=\$5
+joined = set --model=$1-dev
+plain = status --format yaml
+`
+	err := ioutil.WriteFile(filename, []byte(content), 0644)
+	c.Assert(err, gc.IsNil)
+	aliases, err := cmd.ReadAliasFile(filename)
+	c.Assert(err, gc.IsNil)
+	c.Assert(aliases, gc.DeepEquals, map[string]cmd.Alias{
+		"to": {
+			Name:        "to",
+			Args:        []string{"deploy", "$1", "--to", "$2"},
+			Description: "Deploy a charm to a machine. Usage: to <charm> <machine>",
+			Line:        5,
+			Version:     2,
+		},
+		"quoted": {
+			Name:    "quoted",
+			Args:    []string{"config", "--set", "name=a b", `path="c d"`, "e f"},
+			Line:    6,
+			Version: 2,
+		},
+		"all": {
+			Name:    "all",
+			Args:    []string{"run", "--all", "--", "$@"},
+			Line:    7,
+			Version: 2,
+		},
+		"dollars": {
+			Name:    "dollars",
+			Args:    []string{"echo", "$$1", "$$2", "$$@", "cost=$$5"},
+			Line:    8,
+			Version: 2,
+		},
+		"joined": {
+			Name:    "joined",
+			Args:    []string{"set", "--model=$1-dev"},
+			Line:    9,
+			Version: 2,
+		},
+		"plain": {
+			Name:    "plain",
+			Args:    []string{"status", "--format", "yaml"},
+			Line:    10,
+			Version: 2,
+		},
+	})
+}
+
+func (*ParseAliasFileSuite) TestReadErrors(c *gc.C) {
+	for i, t := range []struct {
+		content string
+		err     string
+	}{{
+		content: "foo = bar\nno equals sign\n",
+		err:     `.*aliases:2: expected name = value: no equals sign`,
+	}, {
+		content: "# alias-format: 2\nfoo = bar 'baz\n",
+		err:     `.*aliases:2: unterminated single quote`,
+	}, {
+		content: "# alias-format: 2\n\nfoo = bar \"baz\n",
+		err:     `.*aliases:3: unterminated double quote`,
+	}, {
+		content: "# alias-format: 2\nfoo = bar baz\\",
+		err:     `.*aliases:2: unfinished escape at end of line`,
+	}, {
+		content: "# alias-format: 2\nfoo = echo $HOME\n",
+		err:     `.*aliases:2: invalid placeholder "\$HOME" \(use \$1 to \$9 or \$@, or \\\$ for a literal \$\)`,
+	}, {
+		content: "# alias-format: 2\nfoo = echo x$@\n",
+		err:     `.*aliases:2: \$@ must be a separate argument`,
+	}, {
+		content: "# alias-format: 2\nfoo = $1 status\n",
+		err:     `.*aliases:2: alias "foo" must start with a command, not a placeholder`,
+	}, {
+		content: "# alias-format: 2\n'foo' = status\n",
+		err:     `.*aliases:2: invalid alias name "'foo'"`,
+	}, {
+		content: "# alias-format: 2\nfoo = status\nfoo = help\n",
+		err:     `.*aliases:3: alias "foo" already defined on line 2`,
+	}, {
+		content: "# alias-format: 2\nfoo = # nothing\n",
+		err:     `.*aliases:2: missing alias value: foo = # nothing`,
+	}} {
+		c.Logf("test %d", i)
+		filename := filepath.Join(c.MkDir(), "aliases")
+		err := ioutil.WriteFile(filename, []byte(t.content), 0644)
+		c.Assert(err, gc.IsNil)
+		aliases, err := cmd.ReadAliasFile(filename)
+		c.Check(err, gc.ErrorMatches, t.err)
+		c.Check(err, gc.FitsTypeOf, cmd.AliasFileErrors{})
+		c.Check(aliases, gc.NotNil)
+	}
+}
+
+func (*ParseAliasFileSuite) TestReadAllErrors(c *gc.C) {
+	filename := filepath.Join(c.MkDir(), "aliases")
+	err := ioutil.WriteFile(filename, []byte("# alias-format: 2\nfoo = bar 'baz\nok = status\nqux = echo $HOME\n"), 0644)
+	c.Assert(err, gc.IsNil)
+	aliases, err := cmd.ReadAliasFile(filename)
+	c.Check(aliases, gc.HasLen, 1)
+	c.Assert(err, gc.FitsTypeOf, cmd.AliasFileErrors{})
+	errs := err.(cmd.AliasFileErrors)
+	c.Assert(errs, gc.HasLen, 2)
+	c.Check(errs[0].Line, gc.Equals, 2)
+	c.Check(errs[1].Line, gc.Equals, 4)
+	c.Check(err, gc.ErrorMatches, `.*aliases:2: unterminated single quote\n.*aliases:4: invalid placeholder .*`)
+}
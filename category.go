@@ -0,0 +1,177 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Category describes a group of subcommands in help listings.
+type Category struct {
+	// Name is the category given in the Info of the commands in the
+	// group. "help commands <name>" lists just those commands.
+	Name string
+
+	// Title, if set, heads the group's section of the listing. It
+	// defaults to the name followed by " commands".
+	Title string
+}
+
+// otherCommandsTitle heads the section listing the subcommands that have
+// no category, when others do.
+const otherCommandsTitle = "other commands"
+
+// commandEntry holds the details of a subcommand as it is listed by
+// describeCommands.
+type commandEntry struct {
+	name     string
+	purpose  string
+	category string
+}
+
+// commandGroup holds the subcommands listed in a section of the output
+// of describeCommands.
+type commandGroup struct {
+	category string
+	title    string
+	entries  []commandEntry
+}
+
+// commandEntries returns the entries for the listed, non-deprecated
+// subcommands of c, its described user aliases and, if withPlugins is
+// true, its plugins, in name order, along with the length of the longest
+// name.
+func (c *SuperCommand) commandEntries(withPlugins bool) ([]commandEntry, int) {
+	var cmds []string
+	longest := 0
+	for name, action := range c.subcmds {
+		if !action.listed() {
+			continue
+		}
+		if len(name) > longest {
+			longest = len(name)
+		}
+		cmds = append(cmds, name)
+	}
+	// User aliases are listed if they are described.
+	for name, alias := range c.userAliases {
+		if _, found := c.subcmds[name]; found || alias.Description == "" {
+			continue
+		}
+		if len(name) > longest {
+			longest = len(name)
+		}
+		cmds = append(cmds, name)
+	}
+	var plugins map[string]commandEntry
+	if withPlugins {
+		plugins = c.pluginEntries()
+	}
+	for name := range plugins {
+		if len(name) > longest {
+			longest = len(name)
+		}
+		cmds = append(cmds, name)
+	}
+	sort.Strings(cmds)
+	var entries []commandEntry
+	for _, name := range cmds {
+		if entry, found := plugins[name]; found {
+			entries = append(entries, entry)
+			continue
+		}
+		action, found := c.subcmds[name]
+		if !found {
+			// User aliases are listed with the command they run.
+			entry := commandEntry{name: name, purpose: c.userAliases[name].Description}
+			if action, found := c.subcmds[c.aliasTarget(name)]; found {
+				entry.category = action.command.Info().Category
+			}
+			entries = append(entries, entry)
+			continue
+		}
+		if deprecated, _ := action.Deprecated(); deprecated {
+			continue
+		}
+		info := action.command.Info()
+		purpose := info.Purpose
+		if action.alias != "" {
+			purpose = "alias for '" + action.alias + "'"
+		}
+		entries = append(entries, commandEntry{name: name, purpose: purpose, category: info.Category})
+	}
+	return entries, longest
+}
+
+// groupCommands returns entries grouped by category. The groups are in
+// the order given by c's categories, followed by the other categories in
+// alphabetical order, and then by the entries without a category.
+func (c *SuperCommand) groupCommands(entries []commandEntry) []commandGroup {
+	byCategory := make(map[string][]commandEntry)
+	for _, entry := range entries {
+		byCategory[entry.category] = append(byCategory[entry.category], entry)
+	}
+	var groups []commandGroup
+	add := func(category, title string) {
+		if _, found := byCategory[category]; !found {
+			return
+		}
+		if title == "" {
+			title = category + " commands"
+		}
+		groups = append(groups, commandGroup{category, title, byCategory[category]})
+		delete(byCategory, category)
+	}
+	for _, category := range c.categories {
+		if category.Name != "" {
+			add(category.Name, category.Title)
+		}
+	}
+	var rest []string
+	for category := range byCategory {
+		if category != "" {
+			rest = append(rest, category)
+		}
+	}
+	sort.Strings(rest)
+	for _, category := range rest {
+		add(category, "")
+	}
+	add("", otherCommandsTitle)
+	return groups
+}
+
+// categoryNames returns the names of the categories of the subcommands
+// and plugins listed by "help commands".
+func (c *SuperCommand) categoryNames() []string {
+	entries, _ := c.commandEntries(true)
+	var names []string
+	for _, group := range c.groupCommands(entries) {
+		if group.category != "" {
+			names = append(names, group.category)
+		}
+	}
+	return names
+}
+
+// describeCategory returns a short description of each subcommand in the
+// given category, as listed by "help commands".
+func (c *SuperCommand) describeCategory(category string) string {
+	entries, _ := c.commandEntries(true)
+	longest := 0
+	var result []string
+	for _, entry := range entries {
+		if entry.category == category && len(entry.name) > longest {
+			longest = len(entry.name)
+		}
+	}
+	for _, entry := range entries {
+		if entry.category == category {
+			result = append(result, fmt.Sprintf("%-*s  %s", longest, entry.name, entry.purpose))
+		}
+	}
+	return strings.Join(result, "\n")
+}
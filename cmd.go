@@ -5,6 +5,7 @@ package cmd
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -13,6 +14,8 @@ import (
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 
 	"launchpad.net/gnuflag"
 )
@@ -50,7 +53,8 @@ func IsErrSilent(err error) bool {
 	if err == ErrSilent {
 		return true
 	}
-	if _, ok := err.(*RcPassthroughError); ok {
+	switch err.(type) {
+	case *RcPassthroughError, *silentError:
 		return true
 	}
 	return false
@@ -79,6 +83,14 @@ type Command interface {
 	AllowInterspersedFlags() bool
 }
 
+// contextCommand is implemented by commands that need the Context they
+// will be run in before Init is called. Main passes it to them with
+// setContext once the command line has been parsed.
+type contextCommand interface {
+	Command
+	setContext(ctx *Context)
+}
+
 // CommandBase provides the default implementation for SetFlags, Init, and Help.
 type CommandBase struct{}
 
@@ -104,6 +116,10 @@ func (c *CommandBase) AllowInterspersedFlags() bool {
 // Context represents the run context of a Command. Command implementations
 // should interpret file names relative to Dir (see AbsPath below), and print
 // output and errors to Stdout and Stderr respectively.
+//
+// Context also implements context.Context. When a command is run by Main,
+// it is cancelled when the process is interrupted, so long-running commands
+// can stop cleanly by watching Done.
 type Context struct {
 	Dir     string
 	Env     map[string]string
@@ -112,6 +128,45 @@ type Context struct {
 	Stderr  io.Writer
 	quiet   bool
 	verbose bool
+	stdctx  context.Context
+
+	// log holds the Log that was started in the context, if any.
+	log *Log
+}
+
+// SetContext sets the standard library context that ctx delegates to
+// when used as a context.Context.
+func (ctx *Context) SetContext(stdctx context.Context) {
+	ctx.stdctx = stdctx
+}
+
+// context returns the standard library context that ctx delegates to,
+// which defaults to context.Background().
+func (ctx *Context) context() context.Context {
+	if ctx.stdctx == nil {
+		return context.Background()
+	}
+	return ctx.stdctx
+}
+
+// Deadline implements context.Context.
+func (ctx *Context) Deadline() (time.Time, bool) {
+	return ctx.context().Deadline()
+}
+
+// Done implements context.Context.
+func (ctx *Context) Done() <-chan struct{} {
+	return ctx.context().Done()
+}
+
+// Err implements context.Context.
+func (ctx *Context) Err() error {
+	return ctx.context().Err()
+}
+
+// Value implements context.Context.
+func (ctx *Context) Value(key interface{}) interface{} {
+	return ctx.context().Value(key)
 }
 
 func (ctx *Context) write(format string, params ...interface{}) {
@@ -184,12 +239,68 @@ func (ctx *Context) GetStderr() io.Writer {
 
 // InterruptNotify satisfies environs.BootstrapContext
 func (ctx *Context) InterruptNotify(c chan<- os.Signal) {
-	signal.Notify(c, os.Interrupt)
+	signalNotify(c, os.Interrupt)
 }
 
 // StopInterruptNotify satisfies environs.BootstrapContext
 func (ctx *Context) StopInterruptNotify(c chan<- os.Signal) {
-	signal.Stop(c)
+	signalStop(c)
+}
+
+// interruptSignals are the signals that cancel a command run by Main.
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// These are variables so that they can be replaced in tests.
+var (
+	signalNotify = signal.Notify
+	signalStop   = signal.Stop
+	osExit       = os.Exit
+)
+
+// cancelOnInterrupt arranges for ctx to be cancelled when the process is
+// interrupted or terminated. If a second such signal arrives before stop
+// is called, the process exits immediately. The interrupted function
+// reports whether ctx has been cancelled by a signal.
+func (ctx *Context) cancelOnInterrupt() (interrupted func() bool, stop func()) {
+	parent := ctx.stdctx
+	stdctx, cancel := context.WithCancel(ctx.context())
+	ctx.stdctx = stdctx
+
+	signals := make(chan os.Signal, 2)
+	signalNotify(signals, interruptSignals...)
+	done := make(chan struct{})
+	received := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.Infof("received %v, cancelling; signal again to exit immediately", sig)
+			close(received)
+			cancel()
+		case <-done:
+			return
+		}
+		select {
+		case sig := <-signals:
+			logger.Infof("received %v, exiting", sig)
+			osExit(ExitInterrupted)
+		case <-done:
+		}
+	}()
+	interrupted = func() bool {
+		select {
+		case <-received:
+			return true
+		default:
+			return false
+		}
+	}
+	stop = func() {
+		signalStop(signals)
+		close(done)
+		cancel()
+		ctx.stdctx = parent
+	}
+	return interrupted, stop
 }
 
 // Info holds some of the usage documentation of a Command.
@@ -208,6 +319,22 @@ type Info struct {
 
 	// Aliases are other names for the Command.
 	Aliases []string
+
+	// Category, if set, names the group of commands that the Command
+	// is listed with by "help commands".
+	Category string
+
+	// FlagEnv maps the names of flags to environment variables that
+	// set them when they are not given on the command line. When the
+	// Command is registered with a SuperCommand, these bindings take
+	// precedence over those implied by its FlagEnvPrefix, and an empty
+	// variable name leaves the flag unbound.
+	FlagEnv map[string]string
+
+	// FlagDeprecations marks flags of the Command that are being
+	// phased out, keyed by flag name. Flags that are no longer defined
+	// may be marked as obsolete, so that using them gives guidance.
+	FlagDeprecations map[string]FlagDeprecation
 }
 
 // Help renders i's content, along with documentation for any
@@ -215,8 +342,9 @@ type Info struct {
 func (i *Info) Help(f *gnuflag.FlagSet) []byte {
 	buf := &bytes.Buffer{}
 	fmt.Fprintf(buf, "Usage: %s", i.Name)
+	visible := visibleFlags(f, i.FlagDeprecations)
 	hasOptions := false
-	f.VisitAll(func(f *gnuflag.Flag) { hasOptions = true })
+	visible.VisitAll(func(f *gnuflag.Flag) { hasOptions = true })
 	if hasOptions {
 		fmt.Fprintf(buf, " [options]")
 	}
@@ -229,8 +357,7 @@ func (i *Info) Help(f *gnuflag.FlagSet) []byte {
 	}
 	if hasOptions {
 		fmt.Fprintf(buf, "\nOptions:\n")
-		f.SetOutput(buf)
-		f.PrintDefaults()
+		printFlagDefaults(buf, visible, i.FlagEnv)
 	}
 	f.SetOutput(ioutil.Discard)
 	if i.Doc != "" {
@@ -250,26 +377,48 @@ func (i *Info) Help(f *gnuflag.FlagSet) []byte {
 func handleCommandError(c Command, ctx *Context, err error, f *gnuflag.FlagSet) (rc int, done bool) {
 	switch err {
 	case nil:
-		return 0, false
+		return ExitSuccess, false
 	case gnuflag.ErrHelp:
 		ctx.Stdout.Write(c.Info().Help(f))
-		return 0, true
+		return ExitSuccess, true
 	case ErrSilent:
-		return 2, true
+		return ExitUsage, true
 	default:
-		fmt.Fprintf(ctx.Stderr, "error: %v\n", err)
-		return 2, true
+		code, ok := exitCodeOf(err)
+		if !ok {
+			code = ExitUsage
+		}
+		writeError(c, ctx, err, code)
+		return code, true
 	}
 }
 
 // Main runs the given Command in the supplied Context with the given
 // arguments, which should not include the command name. It returns a code
-// suitable for passing to os.Exit.
+// suitable for passing to os.Exit: ExitSuccess, ExitUsage if the command
+// line is not valid, or ExitFailure if the command fails, unless the
+// error implements ExitCoder.
+//
+// While the command runs, the first SIGINT or SIGTERM cancels ctx, and
+// a failure after that is reported as ExitInterrupted; a second signal
+// makes the process exit immediately with ExitInterrupted.
 func Main(c Command, ctx *Context, args []string) int {
 	f := gnuflag.NewFlagSet(c.Info().Name, gnuflag.ContinueOnError)
 	f.SetOutput(ioutil.Discard)
 	c.SetFlags(f)
-	if rc, done := handleCommandError(c, ctx, f.Parse(c.AllowInterspersedFlags(), args), f); done {
+	if rc, done := handleCommandError(c, ctx, suggestFlag(f, c.Info().FlagDeprecations, f.Parse(c.AllowInterspersedFlags(), args)), f); done {
+		return rc
+	}
+	if rc, done := handleCommandError(c, ctx, checkCommandFlags(c, ctx, f), f); done {
+		return rc
+	}
+	if cc, ok := c.(contextCommand); ok {
+		cc.setContext(ctx)
+	}
+	if rc, done := handleCommandError(c, ctx, setFlagsFromEnvironment(c, ctx, f), f); done {
+		return rc
+	}
+	if rc, done := handleCommandError(c, ctx, checkParsedFlags(f), f); done {
 		return rc
 	}
 	// Since SuperCommands can also return gnuflag.ErrHelp errors, we need to
@@ -277,19 +426,26 @@ func Main(c Command, ctx *Context, args []string) int {
 	if rc, done := handleCommandError(c, ctx, c.Init(f.Args()), f); done {
 		return rc
 	}
+	interrupted, stop := ctx.cancelOnInterrupt()
+	defer stop()
 	if err := c.Run(ctx); err != nil {
-		if IsRcPassthroughError(err) {
-			return err.(*RcPassthroughError).Code
+		code, ok := exitCodeOf(err)
+		if !ok {
+			code = ExitFailure
+			if interrupted() {
+				code = ExitInterrupted
+			}
 		}
-		if err != ErrSilent {
-			fmt.Fprintf(ctx.Stderr, "error: %v\n", err)
+		if !IsErrSilent(err) {
+			writeError(c, ctx, err, code)
 		}
-		return 1
+		return code
 	}
-	return 0
+	return ExitSuccess
 }
 
 // DefaultContext returns a Context suitable for use in non-hosted situations.
+// Its Env holds the process's environment.
 func DefaultContext() (*Context, error) {
 	dir, err := os.Getwd()
 	if err != nil {
@@ -299,8 +455,15 @@ func DefaultContext() (*Context, error) {
 	if err != nil {
 		return nil, err
 	}
+	env := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
 	return &Context{
 		Dir:    abs,
+		Env:    env,
 		Stdin:  os.Stdin,
 		Stdout: os.Stdout,
 		Stderr: os.Stderr,
@@ -5,12 +5,17 @@ package cmd_test
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"syscall"
+	"time"
 
 	"launchpad.net/gnuflag"
 
+	gitjujutesting "github.com/juju/testing"
 	gc "gopkg.in/check.v1"
 
 	"github.com/juju/cmd"
@@ -146,6 +151,15 @@ func (s *CmdSuite) TestDefaultContextReturnsErrorInDeletedDirectory(c *gc.C) {
 	c.Assert(ctx, gc.IsNil)
 }
 
+func (s *CmdSuite) TestDefaultContextEnv(c *gc.C) {
+	err := os.Setenv("JUJU_CMD_TEST", "a=b")
+	c.Assert(err, gc.IsNil)
+	defer os.Unsetenv("JUJU_CMD_TEST")
+	ctx, err := cmd.DefaultContext()
+	c.Assert(err, gc.IsNil)
+	c.Assert(ctx.Getenv("JUJU_CMD_TEST"), gc.Equals, "a=b")
+}
+
 func (s *CmdSuite) TestCheckEmpty(c *gc.C) {
 	c.Assert(cmd.CheckEmpty(nil), gc.IsNil)
 	c.Assert(cmd.CheckEmpty([]string{"boo!"}), gc.ErrorMatches, `unrecognized args: \["boo!"\]`)
@@ -211,3 +225,126 @@ func (s *CmdSuite) TestInfoHelp(c *gc.C) {
 		c.Check(got, gc.Equals, want)
 	}
 }
+
+func (s *CmdSuite) TestContextIsContext(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	var _ context.Context = ctx
+	c.Assert(ctx.Err(), gc.IsNil)
+	_, ok := ctx.Deadline()
+	c.Assert(ok, gc.Equals, false)
+
+	stdctx, cancel := context.WithCancel(context.WithValue(context.Background(), "key", "value"))
+	ctx.SetContext(stdctx)
+	c.Assert(ctx.Value("key"), gc.Equals, "value")
+	cancel()
+	select {
+	case <-ctx.Done():
+	case <-time.After(gitjujutesting.LongWait):
+		c.Fatalf("context not cancelled")
+	}
+	c.Assert(ctx.Err(), gc.Equals, context.Canceled)
+}
+
+// waitCommand runs until its context is done, or until it is released
+// if it ignores cancellation.
+type waitCommand struct {
+	cmd.CommandBase
+	started      chan struct{}
+	release      chan struct{}
+	ignoreCancel bool
+	err          error
+}
+
+func (c *waitCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "wait"}
+}
+
+func (c *waitCommand) Run(ctx *cmd.Context) error {
+	if c.started != nil {
+		close(c.started)
+	}
+	done := ctx.Done()
+	if c.ignoreCancel {
+		done = c.release
+	}
+	select {
+	case <-done:
+		c.err = ctx.Err()
+	case <-time.After(gitjujutesting.LongWait):
+		c.err = errors.New("command not stopped")
+	}
+	return c.err
+}
+
+type InterruptSuite struct {
+	gitjujutesting.IsolationSuite
+	notified chan chan<- os.Signal
+	exited   chan int
+}
+
+var _ = gc.Suite(&InterruptSuite{})
+
+func (s *InterruptSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.notified = make(chan chan<- os.Signal, 1)
+	s.exited = make(chan int, 1)
+	s.PatchValue(cmd.SignalNotify, func(ch chan<- os.Signal, sig ...os.Signal) {
+		c.Check(sig, gc.DeepEquals, []os.Signal{os.Interrupt, syscall.SIGTERM})
+		s.notified <- ch
+	})
+	s.PatchValue(cmd.SignalStop, func(chan<- os.Signal) {})
+	s.PatchValue(cmd.OSExit, func(code int) { s.exited <- code })
+}
+
+func (s *InterruptSuite) signals(c *gc.C) chan<- os.Signal {
+	select {
+	case ch := <-s.notified:
+		return ch
+	case <-time.After(gitjujutesting.LongWait):
+		c.Fatalf("signals not watched")
+	}
+	return nil
+}
+
+func (s *InterruptSuite) waitCode(c *gc.C, codes <-chan int) int {
+	select {
+	case code := <-codes:
+		return code
+	case <-time.After(gitjujutesting.LongWait):
+		c.Fatalf("timed out waiting for exit code")
+	}
+	return -1
+}
+
+func (s *InterruptSuite) TestInterruptCancelsContext(c *gc.C) {
+	command := &waitCommand{started: make(chan struct{})}
+	ctx := cmdtesting.Context(c)
+	result := make(chan int, 1)
+	go func() {
+		result <- cmd.Main(command, ctx, nil)
+	}()
+	signals := s.signals(c)
+	<-command.started
+	signals <- os.Interrupt
+	c.Check(s.waitCode(c, result), gc.Equals, cmd.ExitInterrupted)
+	c.Check(command.err, gc.Equals, context.Canceled)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: context canceled\n")
+	c.Check(ctx.Err(), gc.IsNil)
+	c.Check(s.exited, gc.HasLen, 0)
+}
+
+func (s *InterruptSuite) TestSecondSignalForcesExit(c *gc.C) {
+	command := &waitCommand{ignoreCancel: true, release: make(chan struct{})}
+	ctx := cmdtesting.Context(c)
+	result := make(chan int, 1)
+	go func() {
+		result <- cmd.Main(command, ctx, nil)
+	}()
+	signals := s.signals(c)
+	signals <- os.Interrupt
+	signals <- syscall.SIGTERM
+	c.Check(s.waitCode(c, s.exited), gc.Equals, cmd.ExitInterrupted)
+	close(command.release)
+	c.Check(s.waitCode(c, result), gc.Equals, cmd.ExitInterrupted)
+	c.Check(command.err, gc.Equals, context.Canceled)
+}
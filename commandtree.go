@@ -0,0 +1,248 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"sort"
+	"strings"
+
+	"launchpad.net/gnuflag"
+)
+
+// commandNode describes a command in the tree of commands registered
+// beneath a SuperCommand. The tree is used to write completion scripts,
+// man pages and reference documentation.
+type commandNode struct {
+	// path holds the names of the command and its parents, starting
+	// with the root SuperCommand.
+	path  []string
+	info  *Info
+	usage string
+	flags []commandFlag
+	// aliases holds the aliases that run the command.
+	aliases []commandAlias
+	// aliasEntries holds the aliases registered with a SuperCommand,
+	// and its user aliases.
+	aliasEntries []commandAlias
+	subcmds      []*commandNode
+	deprecated   bool
+	replacement  string
+	// topics holds the help topics of the root SuperCommand.
+	topics []docTopic
+}
+
+// commandAlias describes an alias for a command.
+type commandAlias struct {
+	// name and target are the full names of the alias and of the
+	// command it runs.
+	name        string
+	target      string
+	deprecated  bool
+	replacement string
+	// userArgs holds the command line run by a user alias, which is
+	// described by description; both are empty for registered aliases.
+	userArgs    []string
+	description string
+}
+
+// commandFlag describes a flag along with any other names that share
+// its value, e.g. "-h" and "--help".
+type commandFlag struct {
+	names    []string
+	usage    string
+	defValue string
+	isBool   bool
+}
+
+// docTopic describes a help topic.
+type docTopic struct {
+	name  string
+	short string
+	long  string
+}
+
+// builtinHelpTopics holds the help topics that every SuperCommand has,
+// which are covered elsewhere in generated documentation.
+var builtinHelpTopics = map[string]bool{
+	"commands":       true,
+	"global-options": true,
+	"topics":         true,
+}
+
+// commandTree returns the node for c and everything registered beneath
+// it. Deprecated commands and aliases are only included if
+// includeDeprecated is true.
+func (c *SuperCommand) commandTree(includeDeprecated bool) *commandNode {
+	f := visibleFlags(c.inspectFlags(false), c.flagDeprecations)
+	root := &commandNode{
+		path:  []string{c.Name},
+		info:  c.docInfo(),
+		usage: docUsage(c.Name, c.docInfo(), f),
+		flags: commandFlags(f),
+	}
+	for name, topic := range c.help.topics {
+		if topic.alias || !topic.listed() || topic.describe != nil || builtinHelpTopics[name] {
+			continue
+		}
+		root.topics = append(root.topics, docTopic{
+			name:  name,
+			short: topic.short,
+			long:  strings.TrimSpace(topic.long()),
+		})
+	}
+	sort.Sort(docTopicsByName(root.topics))
+	aliases := make(map[string][]commandAlias)
+	c.addSubcmdNodes(root, aliases, includeDeprecated)
+	root.walk(func(node *commandNode) {
+		node.aliases = aliases[node.name()]
+	})
+	return root
+}
+
+// docInfo returns the Info for c itself, regardless of any subcommand
+// selected by Init.
+func (c *SuperCommand) docInfo() *Info {
+	return &Info{
+		Name:    c.Name,
+		Args:    "<command> ...",
+		Purpose: c.Purpose,
+		Doc:     c.Doc,
+		Aliases: c.Aliases,
+	}
+}
+
+// addSubcmdNodes adds a node for each of the subcommands of c to node,
+// and an entry for each of its aliases, which are also recorded in
+// aliases, keyed by the full name of the command they run.
+func (c *SuperCommand) addSubcmdNodes(node *commandNode, aliases map[string][]commandAlias, includeDeprecated bool) {
+	var names []string
+	for name := range c.subcmds {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		action := c.subcmds[name]
+		deprecated, replacement := action.Deprecated()
+		if deprecated && !includeDeprecated || !action.listed() {
+			continue
+		}
+		if action.alias != "" {
+			node.addAlias(aliases, commandAlias{
+				name:        node.name() + " " + name,
+				target:      node.name() + " " + action.alias,
+				deprecated:  deprecated,
+				replacement: replacement,
+			})
+			continue
+		}
+		f := c.inspectFlags(true)
+		child := &commandNode{
+			path:        append(append([]string(nil), node.path...), name),
+			deprecated:  deprecated,
+			replacement: replacement,
+		}
+		if super, ok := action.command.(*SuperCommand); ok {
+			child.info = super.docInfo()
+			super.addSubcmdNodes(child, aliases, includeDeprecated)
+		} else {
+			child.info = action.command.Info()
+			action.command.SetFlags(f)
+		}
+		f = visibleFlags(f, c.subcommandFlagDeprecations(action.command))
+		child.usage = docUsage(child.name(), child.info, f)
+		child.flags = commandFlags(f)
+		node.subcmds = append(node.subcmds, child)
+	}
+	var userNames []string
+	for name := range c.userAliases {
+		if _, found := c.subcmds[name]; !found {
+			userNames = append(userNames, name)
+		}
+	}
+	sort.Strings(userNames)
+	for _, name := range userNames {
+		target := c.aliasTarget(name)
+		if action, found := c.subcmds[target]; found && action.alias != "" {
+			target = action.alias
+		}
+		node.addAlias(aliases, commandAlias{
+			name:        node.name() + " " + name,
+			target:      node.name() + " " + target,
+			userArgs:    c.userAliases[name].Args,
+			description: c.userAliases[name].Description,
+		})
+	}
+}
+
+// addAlias adds alias to the entries of node, and records it in aliases.
+func (node *commandNode) addAlias(aliases map[string][]commandAlias, alias commandAlias) {
+	aliases[alias.target] = append(aliases[alias.target], alias)
+	node.aliasEntries = append(node.aliasEntries, alias)
+}
+
+// docUsage returns the usage line that Info.Help shows for the named
+// command, e.g. "Usage: juju bootstrap [options] <cloud>".
+func docUsage(name string, info *Info, f *gnuflag.FlagSet) string {
+	usageInfo := &Info{Name: name, Args: info.Args}
+	return firstLine(string(usageInfo.Help(f)))
+}
+
+// commandFlags returns the flags defined in f, with flags that share a
+// value described together.
+func commandFlags(f *gnuflag.FlagSet) []commandFlag {
+	var flags []commandFlag
+	byValue := make(map[gnuflag.Value]int)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		name := "--" + flag.Name
+		if len(flag.Name) == 1 {
+			name = "-" + flag.Name
+		}
+		if i, found := byValue[flag.Value]; found {
+			flags[i].names = append(flags[i].names, name)
+			if flags[i].usage == "" {
+				flags[i].usage = flag.Usage
+			}
+			return
+		}
+		byValue[flag.Value] = len(flags)
+		flags = append(flags, commandFlag{
+			names:    []string{name},
+			usage:    flag.Usage,
+			defValue: flag.DefValue,
+			isBool:   isBoolFlag(flag),
+		})
+	})
+	return flags
+}
+
+// lookup returns the node for the command with the given full name, or
+// nil if there is none.
+func (node *commandNode) lookup(name string) *commandNode {
+	var found *commandNode
+	node.walk(func(n *commandNode) {
+		if found == nil && n.name() == name {
+			found = n
+		}
+	})
+	return found
+}
+
+// name returns the full name of the command, e.g. "juju bootstrap".
+func (node *commandNode) name() string {
+	return strings.Join(node.path, " ")
+}
+
+// walk calls fn for node and each of its descendants, depth first.
+func (node *commandNode) walk(fn func(*commandNode)) {
+	fn(node)
+	for _, child := range node.subcmds {
+		child.walk(fn)
+	}
+}
+
+type docTopicsByName []docTopic
+
+func (t docTopicsByName) Len() int           { return len(t) }
+func (t docTopicsByName) Less(i, j int) bool { return t[i].name < t[j].name }
+func (t docTopicsByName) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
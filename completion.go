@@ -0,0 +1,665 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/juju/utils"
+	"launchpad.net/gnuflag"
+)
+
+// completionShells holds the functions that render a completion script
+// for each supported shell.
+var completionShells = map[string]func(root *completionNode) []byte{
+	"bash": bashCompletion,
+	"zsh":  zshCompletion,
+	"fish": fishCompletion,
+}
+
+// completionShellNames returns the sorted names of the supported shells.
+func completionShellNames() []string {
+	var names []string
+	for name := range completionShells {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// completionNode describes a command as it is completed on the command
+// line: the flags that are valid after it, and the subcommands and
+// aliases that may follow it.
+type completionNode struct {
+	name    string
+	path    string
+	purpose string
+	flags   []completionFlag
+	subcmds []*completionNode
+}
+
+// completionFlag describes a single flag as it is written on the command
+// line, e.g. "-h" or "--debug".
+type completionFlag struct {
+	name  string
+	usage string
+}
+
+// WriteCompletion writes a completion script for the named shell ("bash",
+// "zsh" or "fish") to w. The script covers all registered subcommands,
+// their aliases and flags, recursing into nested SuperCommands, as well as
+// any user aliases.
+func (c *SuperCommand) WriteCompletion(w io.Writer, shell string) error {
+	render, ok := completionShells[shell]
+	if !ok {
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+	root := c.commandTree(false)
+	_, err := w.Write(render(root.completion(root, c.Name, c.Purpose)))
+	return err
+}
+
+// completion returns the completion node for the command described by
+// node, which is part of the tree under root, when it is run by the
+// given name. Aliases complete as the commands they run.
+func (node *commandNode) completion(root *commandNode, name, purpose string) *completionNode {
+	result := &completionNode{
+		name:    name,
+		path:    name,
+		purpose: purpose,
+	}
+	if len(node.path) > 1 {
+		result.path = strings.Join(node.path[:len(node.path)-1], " ") + " " + name
+	}
+	for _, flag := range node.flags {
+		for _, flagName := range flag.names {
+			result.flags = append(result.flags, completionFlag{name: flagName, usage: flag.usage})
+		}
+	}
+	sort.Sort(completionFlagsByName(result.flags))
+	for _, child := range node.subcmds {
+		result.subcmds = append(result.subcmds, child.completion(root, child.path[len(child.path)-1], child.info.Purpose))
+	}
+	for _, alias := range node.aliasEntries {
+		aliasName := alias.name[len(node.name())+1:]
+		aliasPurpose := "alias for '" + alias.target[len(node.name())+1:] + "'"
+		if alias.userArgs != nil {
+			aliasPurpose = alias.description
+			if aliasPurpose == "" {
+				aliasPurpose = "alias for '" + strings.Join(alias.userArgs, " ") + "'"
+			}
+		}
+		child := &completionNode{
+			name:    aliasName,
+			purpose: aliasPurpose,
+		}
+		if target := root.lookup(alias.target); target != nil {
+			child = target.completion(root, aliasName, aliasPurpose)
+		}
+		child.path = result.path + " " + aliasName
+		child.setPaths()
+		result.subcmds = append(result.subcmds, child)
+	}
+	sort.Sort(completionNodesByName(result.subcmds))
+	return result
+}
+
+// setPaths sets the paths of the descendants of node from its own path.
+func (node *completionNode) setPaths() {
+	for _, child := range node.subcmds {
+		child.path = node.path + " " + child.name
+		child.setPaths()
+	}
+}
+
+type completionNodesByName []*completionNode
+
+func (n completionNodesByName) Len() int           { return len(n) }
+func (n completionNodesByName) Less(i, j int) bool { return n[i].name < n[j].name }
+func (n completionNodesByName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+
+type completionFlagsByName []completionFlag
+
+func (f completionFlagsByName) Len() int { return len(f) }
+func (f completionFlagsByName) Less(i, j int) bool {
+	return strings.TrimLeft(f[i].name, "-") < strings.TrimLeft(f[j].name, "-")
+}
+func (f completionFlagsByName) Swap(i, j int) { f[i], f[j] = f[j], f[i] }
+
+// walk calls fn for node and each of its descendants, depth first.
+func (node *completionNode) walk(fn func(*completionNode)) {
+	fn(node)
+	for _, child := range node.subcmds {
+		child.walk(fn)
+	}
+}
+
+// nestedPaths returns the paths of all the commands below node.
+func (node *completionNode) nestedPaths() []string {
+	var paths []string
+	node.walk(func(n *completionNode) {
+		if n != node {
+			paths = append(paths, n.path)
+		}
+	})
+	return paths
+}
+
+var nonIdentifierChars = regexp.MustCompile("[^A-Za-z0-9_]")
+
+// completionFuncName returns a shell function name derived from the name
+// of the command.
+func completionFuncName(name string) string {
+	return "_" + nonIdentifierChars.ReplaceAllString(name, "_")
+}
+
+// shellQuote quotes s for use in bash and zsh scripts.
+func shellQuote(s string) string {
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// fishQuote quotes s for use in fish scripts.
+func fishQuote(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	return "'" + strings.Replace(s, "'", `\'`, -1) + "'"
+}
+
+// quoteAll applies quote to each of values.
+func quoteAll(values []string, quote func(string) string) []string {
+	result := make([]string, len(values))
+	for i, value := range values {
+		result[i] = quote(value)
+	}
+	return result
+}
+
+// firstLine returns the first line of s, with surrounding space removed.
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "\n"); i >= 0 {
+		s = s[:i]
+	}
+	return s
+}
+
+func bashCompletion(root *completionNode) []byte {
+	buf := &bytes.Buffer{}
+	funcName := completionFuncName(root.name)
+	fmt.Fprintf(buf, "# bash completion for %s\n\n", root.name)
+	fmt.Fprintf(buf, "%s() {\n", funcName)
+	fmt.Fprintf(buf, "    local cur word cmdpath commands flags i\n")
+	fmt.Fprintf(buf, "    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(buf, "    cmdpath=%s\n", shellQuote(root.path))
+	fmt.Fprintf(buf, "    for ((i = 1; i < COMP_CWORD; i++)); do\n")
+	fmt.Fprintf(buf, "        word=\"${COMP_WORDS[i]}\"\n")
+	fmt.Fprintf(buf, "        case \"${cmdpath} ${word}\" in\n")
+	if paths := root.nestedPaths(); len(paths) > 0 {
+		fmt.Fprintf(buf, "        %s)\n", strings.Join(quoteAll(paths, shellQuote), "|"))
+		fmt.Fprintf(buf, "            cmdpath=\"${cmdpath} ${word}\"\n")
+		fmt.Fprintf(buf, "            ;;\n")
+	}
+	fmt.Fprintf(buf, "        esac\n")
+	fmt.Fprintf(buf, "    done\n")
+	fmt.Fprintf(buf, "    case \"${cmdpath}\" in\n")
+	root.walk(func(node *completionNode) {
+		var commands, flags []string
+		for _, child := range node.subcmds {
+			commands = append(commands, child.name)
+		}
+		for _, flag := range node.flags {
+			flags = append(flags, flag.name)
+		}
+		fmt.Fprintf(buf, "    %s)\n", shellQuote(node.path))
+		fmt.Fprintf(buf, "        commands=%s\n", shellQuote(strings.Join(commands, " ")))
+		fmt.Fprintf(buf, "        flags=%s\n", shellQuote(strings.Join(flags, " ")))
+		fmt.Fprintf(buf, "        ;;\n")
+	})
+	fmt.Fprintf(buf, "    esac\n")
+	fmt.Fprintf(buf, "    if [[ \"${cur}\" == -* ]]; then\n")
+	fmt.Fprintf(buf, "        COMPREPLY=($(compgen -W \"${flags}\" -- \"${cur}\"))\n")
+	fmt.Fprintf(buf, "    elif [[ -n \"${commands}\" ]]; then\n")
+	fmt.Fprintf(buf, "        COMPREPLY=($(compgen -W \"${commands}\" -- \"${cur}\"))\n")
+	fmt.Fprintf(buf, "    else\n")
+	fmt.Fprintf(buf, "        local IFS=$'\\n'\n")
+	fmt.Fprintf(buf, "        COMPREPLY=($(\"${COMP_WORDS[0]}\" %s \"${COMP_WORDS[@]:1:COMP_CWORD}\" 2>/dev/null))\n", completeCommandName)
+	fmt.Fprintf(buf, "    fi\n")
+	fmt.Fprintf(buf, "}\n\n")
+	fmt.Fprintf(buf, "complete -o default -F %s %s\n", funcName, root.name)
+	return buf.Bytes()
+}
+
+// zshDescribeItem formats a name and description for use with _describe.
+func zshDescribeItem(name, description string) string {
+	name = strings.Replace(name, ":", `\:`, -1)
+	if description = firstLine(description); description == "" {
+		return shellQuote(name)
+	}
+	return shellQuote(name + ":" + description)
+}
+
+func zshCompletion(root *completionNode) []byte {
+	buf := &bytes.Buffer{}
+	funcName := completionFuncName(root.name)
+	fmt.Fprintf(buf, "#compdef %s\n\n", root.name)
+	fmt.Fprintf(buf, "%s() {\n", funcName)
+	fmt.Fprintf(buf, "    local cmdpath word i\n")
+	fmt.Fprintf(buf, "    local -a commands flags\n")
+	fmt.Fprintf(buf, "    cmdpath=%s\n", shellQuote(root.path))
+	fmt.Fprintf(buf, "    for ((i = 2; i < CURRENT; i++)); do\n")
+	fmt.Fprintf(buf, "        word=\"${words[i]}\"\n")
+	fmt.Fprintf(buf, "        case \"${cmdpath} ${word}\" in\n")
+	if paths := root.nestedPaths(); len(paths) > 0 {
+		fmt.Fprintf(buf, "        (%s)\n", strings.Join(quoteAll(paths, shellQuote), "|"))
+		fmt.Fprintf(buf, "            cmdpath=\"${cmdpath} ${word}\"\n")
+		fmt.Fprintf(buf, "            ;;\n")
+	}
+	fmt.Fprintf(buf, "        esac\n")
+	fmt.Fprintf(buf, "    done\n")
+	fmt.Fprintf(buf, "    case \"${cmdpath}\" in\n")
+	root.walk(func(node *completionNode) {
+		fmt.Fprintf(buf, "    (%s)\n", shellQuote(node.path))
+		fmt.Fprintf(buf, "        commands=(\n")
+		for _, child := range node.subcmds {
+			fmt.Fprintf(buf, "            %s\n", zshDescribeItem(child.name, child.purpose))
+		}
+		fmt.Fprintf(buf, "        )\n")
+		fmt.Fprintf(buf, "        flags=(\n")
+		for _, flag := range node.flags {
+			fmt.Fprintf(buf, "            %s\n", zshDescribeItem(flag.name, flag.usage))
+		}
+		fmt.Fprintf(buf, "        )\n")
+		fmt.Fprintf(buf, "        ;;\n")
+	})
+	fmt.Fprintf(buf, "    esac\n")
+	fmt.Fprintf(buf, "    if [[ \"${PREFIX}\" == -* ]]; then\n")
+	fmt.Fprintf(buf, "        _describe -t options 'option' flags\n")
+	fmt.Fprintf(buf, "    elif (( ${#commands} )); then\n")
+	fmt.Fprintf(buf, "        _describe -t commands 'command' commands\n")
+	fmt.Fprintf(buf, "    else\n")
+	fmt.Fprintf(buf, "        local -a candidates\n")
+	fmt.Fprintf(buf, "        candidates=(\"${(@f)$(\"${words[1]}\" %s \"${(@)words[2,CURRENT]}\" 2>/dev/null)}\")\n", completeCommandName)
+	fmt.Fprintf(buf, "        compadd -- ${candidates:#} || _files\n")
+	fmt.Fprintf(buf, "    fi\n")
+	fmt.Fprintf(buf, "}\n\n")
+	fmt.Fprintf(buf, "if [ \"${funcstack[1]}\" = %s ]; then\n", shellQuote(funcName))
+	fmt.Fprintf(buf, "    %s \"$@\"\n", funcName)
+	fmt.Fprintf(buf, "else\n")
+	fmt.Fprintf(buf, "    compdef %s %s\n", funcName, root.name)
+	fmt.Fprintf(buf, "fi\n")
+	return buf.Bytes()
+}
+
+func fishCompletion(root *completionNode) []byte {
+	buf := &bytes.Buffer{}
+	funcName := completionFuncName(root.name)
+	fmt.Fprintf(buf, "# fish completion for %s\n\n", root.name)
+	fmt.Fprintf(buf, "function %s_cmdpath\n", funcName)
+	fmt.Fprintf(buf, "    set -l words (commandline -opc)\n")
+	fmt.Fprintf(buf, "    set -e words[1]\n")
+	fmt.Fprintf(buf, "    set -l cmdpath %s\n", fishQuote(root.path))
+	fmt.Fprintf(buf, "    for word in $words\n")
+	fmt.Fprintf(buf, "        switch \"$cmdpath $word\"\n")
+	if paths := root.nestedPaths(); len(paths) > 0 {
+		fmt.Fprintf(buf, "            case %s\n", strings.Join(quoteAll(paths, fishQuote), " "))
+		fmt.Fprintf(buf, "                set cmdpath \"$cmdpath $word\"\n")
+	}
+	fmt.Fprintf(buf, "        end\n")
+	fmt.Fprintf(buf, "    end\n")
+	fmt.Fprintf(buf, "    echo $cmdpath\n")
+	fmt.Fprintf(buf, "end\n\n")
+	fmt.Fprintf(buf, "function %s_at\n", funcName)
+	fmt.Fprintf(buf, "    test (%s_cmdpath) = \"$argv[1]\"\n", funcName)
+	fmt.Fprintf(buf, "end\n\n")
+	fmt.Fprintf(buf, "function %s_complete\n", funcName)
+	fmt.Fprintf(buf, "    set -l words (commandline -opc)\n")
+	fmt.Fprintf(buf, "    set -e words[1]\n")
+	fmt.Fprintf(buf, "    %s %s $words (commandline -ct) 2>/dev/null\n", root.name, completeCommandName)
+	fmt.Fprintf(buf, "end\n\n")
+	root.walk(func(node *completionNode) {
+		condition := fishQuote(funcName + "_at " + fishQuote(node.path))
+		for _, child := range node.subcmds {
+			fmt.Fprintf(buf, "complete -c %s -f -n %s -a %s", root.name, condition, fishQuote(child.name))
+			if purpose := firstLine(child.purpose); purpose != "" {
+				fmt.Fprintf(buf, " -d %s", fishQuote(purpose))
+			}
+			fmt.Fprintf(buf, "\n")
+		}
+		for _, flag := range node.flags {
+			option := "-l " + fishQuote(strings.TrimPrefix(flag.name, "--"))
+			if len(flag.name) == 2 {
+				option = "-s " + fishQuote(flag.name[1:])
+			}
+			fmt.Fprintf(buf, "complete -c %s -n %s %s", root.name, condition, option)
+			if usage := firstLine(flag.usage); usage != "" {
+				fmt.Fprintf(buf, " -d %s", fishQuote(usage))
+			}
+			fmt.Fprintf(buf, "\n")
+		}
+		if len(node.subcmds) == 0 {
+			fmt.Fprintf(buf, "complete -c %s -n %s -a %s\n", root.name, condition, fishQuote("("+funcName+"_complete)"))
+		}
+	})
+	return buf.Bytes()
+}
+
+// completionCommand is a cmd.Command that writes a shell completion script
+// for the SuperCommand it is registered with.
+type completionCommand struct {
+	CommandBase
+	super *SuperCommand
+	shell string
+}
+
+func (c *completionCommand) Info() *Info {
+	return &Info{
+		Name:    "completion",
+		Args:    "<" + strings.Join(completionShellNames(), "|") + ">",
+		Purpose: "output a shell completion script",
+		Doc: fmt.Sprintf(`
+The completion script covers all commands, aliases and options of %[1]s.
+To enable completion in the current bash session, run:
+
+    source <(%[1]s completion bash)
+`, c.super.Name),
+	}
+}
+
+func (c *completionCommand) Init(args []string) error {
+	shell, err := ZeroOrOneArgs(args)
+	if err != nil {
+		return err
+	}
+	if shell == "" {
+		return fmt.Errorf("no shell specified")
+	}
+	if _, ok := completionShells[shell]; !ok {
+		return fmt.Errorf("unsupported shell %q", shell)
+	}
+	c.shell = shell
+	return nil
+}
+
+func (c *completionCommand) Run(ctx *Context) error {
+	return c.super.WriteCompletion(ctx.Stdout, c.shell)
+}
+
+// completeCommandName is the name of the hidden subcommand that the
+// generated completion scripts call to complete arguments dynamically.
+const completeCommandName = "__complete"
+
+// Completer may be implemented by a Command to offer candidates when the
+// user completes one of its positional arguments.
+type Completer interface {
+	// Complete returns the candidates for the partial argument, given
+	// the positional args that precede it. Any flags before the cursor
+	// have already been parsed into the command. Only the candidates
+	// that start with partial are offered to the user.
+	Complete(ctx *Context, args []string, partial string) ([]string, error)
+}
+
+// FlagCompleter may be implemented by a Command to offer candidates when
+// the user completes the value of one of its flags. Flags whose value is a
+// *FileVar are completed as paths relative to the context's Dir without
+// the command needing to implement FlagCompleter.
+type FlagCompleter interface {
+	// CompleteFlag returns the candidates for the partial value of the
+	// named flag.
+	CompleteFlag(ctx *Context, name, partial string) ([]string, error)
+}
+
+// completeCommand implements the hidden "__complete" subcommand. Its
+// arguments are the words on the command line after the name of the
+// SuperCommand, the last of which is the word being completed. The
+// candidates are written to Stdout, one per line.
+type completeCommand struct {
+	CommandBase
+	super *SuperCommand
+	words []string
+}
+
+func (c *completeCommand) Info() *Info {
+	return &Info{
+		Name:    completeCommandName,
+		Args:    "[<word> ...]",
+		Purpose: "complete a partial command line",
+	}
+}
+
+func (c *completeCommand) Init(args []string) error {
+	c.words = args
+	return nil
+}
+
+func (c *completeCommand) Run(ctx *Context) error {
+	words, partial := c.words, ""
+	if len(words) > 0 {
+		words, partial = words[:len(words)-1], words[len(words)-1]
+	}
+	candidates, err := c.super.complete(ctx, c.super.inspectFlags(false), words, partial)
+	if err != nil {
+		return err
+	}
+	for _, candidate := range candidates {
+		fmt.Fprintln(ctx.Stdout, candidate)
+	}
+	return nil
+}
+
+// complete returns the candidates for partial, following words. The flags
+// in f are those that may appear before the name of a subcommand of c.
+func (c *SuperCommand) complete(ctx *Context, f *gnuflag.FlagSet, words []string, partial string) ([]string, error) {
+	args, pending := scanFlags(f, false, words)
+	if pending != nil {
+		return completeFlagValue(ctx, nil, pending, partial)
+	}
+	if len(args) == 0 {
+		if strings.HasPrefix(partial, "-") {
+			return completeFlag(ctx, nil, f, partial)
+		}
+		var names []string
+		for name, action := range c.subcmds {
+			if deprecated, _ := action.Deprecated(); !deprecated && action.listed() {
+				names = append(names, name)
+			}
+		}
+		for name := range c.userAliases {
+			if _, found := c.subcmds[name]; !found {
+				names = append(names, name)
+			}
+		}
+		if c.pluginPrefix != "" {
+			for _, plugin := range FindPlugins(ctx, c.pluginPrefix) {
+				_, isAlias := c.userAliases[plugin.Name]
+				if _, found := c.subcmds[plugin.Name]; !found && !isAlias {
+					names = append(names, plugin.Name)
+				}
+			}
+		}
+		sort.Strings(names)
+		return filterPrefix(names, partial), nil
+	}
+
+	name, args := args[0], args[1:]
+	if _, found := c.userAliases[name]; found && !c.noAlias {
+		// Arguments that placeholders need may not have been typed yet.
+		expanded, err := c.expandAliases(append([]string{name}, args...))
+		if err != nil {
+			expanded = append([]string{c.aliasTarget(name)}, args...)
+		}
+		name, args = expanded[0], expanded[1:]
+	}
+	action, found := c.subcmds[name]
+	if !found {
+		return nil, nil
+	}
+	subf := c.inspectFlags(true)
+	if super, ok := action.command.(*SuperCommand); ok {
+		return super.complete(ctx, subf, args, partial)
+	}
+
+	command := action.command
+	command.SetFlags(subf)
+	args, pending = scanFlags(subf, command.AllowInterspersedFlags(), args)
+	if pending != nil {
+		return completeFlagValue(ctx, command, pending, partial)
+	}
+	if strings.HasPrefix(partial, "-") && (len(args) == 0 || command.AllowInterspersedFlags()) {
+		return completeFlag(ctx, command, subf, partial)
+	}
+	completer, ok := command.(Completer)
+	if !ok {
+		return nil, nil
+	}
+	candidates, err := completer.Complete(ctx, args, partial)
+	if err != nil {
+		return nil, err
+	}
+	return filterPrefix(candidates, partial), nil
+}
+
+// scanFlags parses the flags in words into f, as Init would, and returns
+// the remaining positional args. If the last word is a flag that needs a
+// value, that flag is returned as pending.
+func scanFlags(f *gnuflag.FlagSet, allowIntersperse bool, words []string) (args []string, pending *gnuflag.Flag) {
+	var flagWords []string
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if word == "--" {
+			args = append(args, words[i+1:]...)
+			break
+		}
+		if len(word) < 2 || word[0] != '-' {
+			if !allowIntersperse {
+				args = append(args, words[i:]...)
+				break
+			}
+			args = append(args, word)
+			continue
+		}
+		flagWords = append(flagWords, word)
+		if strings.Contains(word, "=") {
+			continue
+		}
+		name := strings.TrimLeft(word, "-")
+		if !strings.HasPrefix(word, "--") {
+			// Only the last of a group of short flags may take a value.
+			name = name[len(name)-1:]
+		}
+		flag := f.Lookup(name)
+		if flag == nil || isBoolFlag(flag) {
+			continue
+		}
+		if i+1 == len(words) {
+			pending = flag
+			break
+		}
+		i++
+		flagWords = append(flagWords, words[i])
+	}
+	// Errors are ignored; completion does the best it can with the flags
+	// that were understood.
+	f.Parse(true, flagWords)
+	return args, pending
+}
+
+// isBoolFlag returns whether flag is a boolean flag, which takes no value.
+func isBoolFlag(flag *gnuflag.Flag) bool {
+	b, ok := flag.Value.(interface {
+		IsBoolFlag() bool
+	})
+	return ok && b.IsBoolFlag()
+}
+
+// completeFlag returns the candidates for a partial flag. If partial holds
+// an inline value, such as "--file=foo", the value is completed instead.
+func completeFlag(ctx *Context, command Command, f *gnuflag.FlagSet, partial string) ([]string, error) {
+	if i := strings.Index(partial, "="); i >= 0 {
+		flag := f.Lookup(strings.TrimLeft(partial[:i], "-"))
+		if flag == nil {
+			return nil, nil
+		}
+		values, err := completeFlagValue(ctx, command, flag, partial[i+1:])
+		if err != nil {
+			return nil, err
+		}
+		for j, value := range values {
+			values[j] = partial[:i+1] + value
+		}
+		return values, nil
+	}
+	var names []string
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if len(flag.Name) == 1 {
+			names = append(names, "-"+flag.Name)
+		} else {
+			names = append(names, "--"+flag.Name)
+		}
+	})
+	return filterPrefix(names, partial), nil
+}
+
+// completeFlagValue returns the candidates for the partial value of flag.
+func completeFlagValue(ctx *Context, command Command, flag *gnuflag.Flag, partial string) ([]string, error) {
+	if fileVar, ok := flag.Value.(*FileVar); ok {
+		candidates := filterPrefix(fileVar.StdinMarkers, partial)
+		return append(candidates, completePaths(ctx, partial)...), nil
+	}
+	completer, ok := command.(FlagCompleter)
+	if !ok {
+		return nil, nil
+	}
+	candidates, err := completer.CompleteFlag(ctx, flag.Name, partial)
+	if err != nil {
+		return nil, err
+	}
+	return filterPrefix(candidates, partial), nil
+}
+
+// completePaths returns the files and directories that start with partial,
+// interpreted relative to ctx.Dir. Directories have a trailing separator.
+// Hidden files are only offered if partial names one.
+func completePaths(ctx *Context, partial string) []string {
+	dir, prefix := filepath.Split(partial)
+	searchDir, err := utils.NormalizePath(dir)
+	if err != nil {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(ctx.AbsPath(searchDir))
+	if err != nil {
+		return nil
+	}
+	var candidates []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		if strings.HasPrefix(name, ".") && !strings.HasPrefix(prefix, ".") {
+			continue
+		}
+		if entry.IsDir() {
+			name += string(filepath.Separator)
+		}
+		candidates = append(candidates, dir+name)
+	}
+	return candidates
+}
+
+// filterPrefix returns the values that start with prefix.
+func filterPrefix(values []string, prefix string) []string {
+	var result []string
+	for _, value := range values {
+		if strings.HasPrefix(value, prefix) {
+			result = append(result, value)
+		}
+	}
+	return result
+}
@@ -0,0 +1,211 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/juju/loggo"
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type CompletionSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&CompletionSuite{})
+
+func (s *CompletionSuite) TestRegistered(c *gc.C) {
+	sc := newTestSuper(aliasedParams(c))
+	c.Assert(sc.Info().Doc, jc.Contains, "completion   - output a shell completion script")
+
+	plain := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	_, err := cmdtesting.RunCommand(c, plain, "completion", "bash")
+	c.Assert(err, gc.ErrorMatches, "unrecognized command: jujutest completion")
+}
+
+func (s *CompletionSuite) TestInitErrors(c *gc.C) {
+	_, err := cmdtesting.RunCommand(c, newTestSuper(aliasedParams(c)), "completion")
+	c.Assert(err, gc.ErrorMatches, "no shell specified")
+	_, err = cmdtesting.RunCommand(c, newTestSuper(aliasedParams(c)), "completion", "tcsh")
+	c.Assert(err, gc.ErrorMatches, `unsupported shell "tcsh"`)
+	_, err = cmdtesting.RunCommand(c, newTestSuper(aliasedParams(c)), "completion", "bash", "zsh")
+	c.Assert(err, gc.ErrorMatches, `unrecognized args: \["zsh"\]`)
+}
+
+func (s *CompletionSuite) TestWriteCompletionUnsupported(c *gc.C) {
+	err := newTestSuper(aliasedParams(c)).WriteCompletion(&bytes.Buffer{}, "tcsh")
+	c.Assert(err, gc.ErrorMatches, `unsupported shell "tcsh"`)
+}
+
+func (s *CompletionSuite) TestBash(c *gc.C) {
+	ctx, err := cmdtesting.RunCommand(c, newTestSuper(aliasedParams(c)), "completion", "bash")
+	c.Assert(err, jc.ErrorIsNil)
+	script := cmdtesting.Stdout(ctx)
+	c.Check(script, jc.Contains, "complete -o default -F _jujutest jujutest\n")
+	c.Check(script, jc.Contains, `
+    'jujutest')
+        commands='aliases bar bar-foo completion def defen defenestrate help throw'
+        flags='--debug --description -h --help --log-file --logging-config --no-alias -q --quiet --show-log -v --verbose'
+        ;;
+`)
+	c.Check(script, jc.Contains, `
+    'jujutest bar')
+        commands='foo help'
+        flags='--debug --description -h --help --log-file --logging-config -q --quiet --show-log -v --verbose'
+        ;;
+`)
+	c.Check(script, jc.Contains, `
+    'jujutest def')
+        commands=''
+        flags='--debug --description -h --help --log-file --logging-config --option -q --quiet --show-log -v --verbose'
+        ;;
+`)
+	c.Check(script, jc.Contains, `'jujutest bar'|'jujutest bar foo'|'jujutest bar help'|'jujutest bar-foo'|`)
+	// Deprecated aliases are not offered.
+	c.Check(script, gc.Not(jc.Contains), "old-throw")
+}
+
+func (s *CompletionSuite) TestKeepsParsedFlags(c *gc.C) {
+	sc := newTestSuper(aliasedParams(c))
+	_, err := cmdtesting.RunCommand(c, sc, "--verbose", "completion", "bash")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(sc.Log.Verbose, jc.IsTrue)
+
+	loggo.ResetWriters()
+	sc = newTestSuper(aliasedParams(c))
+	_, err = cmdtesting.RunCommand(c, sc, "--verbose", "__complete", "--debug", "def", "")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(sc.Log.Verbose, jc.IsTrue)
+	c.Check(sc.Log.Debug, jc.IsFalse)
+}
+
+func (s *CompletionSuite) TestZsh(c *gc.C) {
+	ctx, err := cmdtesting.RunCommand(c, newTestSuper(aliasedParams(c)), "completion", "zsh")
+	c.Assert(err, jc.ErrorIsNil)
+	script := cmdtesting.Stdout(ctx)
+	c.Check(script, jc.HasPrefix, "#compdef jujutest\n")
+	c.Check(script, jc.Contains, "    compdef _jujutest jujutest\n")
+	c.Check(script, jc.Contains, `
+    ('jujutest bar')
+        commands=(
+            'foo:to be simple'
+            'help:show help on a command or other topic'
+        )
+`)
+	c.Check(script, jc.Contains, "            'bar-foo:alias for '\\''bar foo'\\'''\n")
+	c.Check(script, jc.Contains, "            'def:alias for '\\''defenestrate --option firmly'\\'''\n")
+	c.Check(script, jc.Contains, "            '--option:option-doc'\n")
+}
+
+func (s *CompletionSuite) TestFish(c *gc.C) {
+	ctx, err := cmdtesting.RunCommand(c, newTestSuper(aliasedParams(c)), "completion", "fish")
+	c.Assert(err, jc.ErrorIsNil)
+	script := cmdtesting.Stdout(ctx)
+	c.Check(script, jc.Contains, "complete -c jujutest -f -n '_jujutest_at \\'jujutest\\'' -a 'bar' -d 'bar functions'\n")
+	c.Check(script, jc.Contains, "complete -c jujutest -f -n '_jujutest_at \\'jujutest bar\\'' -a 'foo' -d 'to be simple'\n")
+	c.Check(script, jc.Contains, "complete -c jujutest -n '_jujutest_at \\'jujutest defenestrate\\'' -l 'option' -d 'option-doc'\n")
+	c.Check(script, jc.Contains, "complete -c jujutest -n '_jujutest_at \\'jujutest\\'' -s 'h' -d 'show help on a command or other topic'\n")
+}
+
+// completingCommand offers candidates for its arguments and flag values.
+type completingCommand struct {
+	cmd.CommandBase
+	model  string
+	file   cmd.FileVar
+	called []string
+}
+
+func (c *completingCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "deploy", Args: "<unit> ..."}
+}
+
+func (c *completingCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&c.model, "m", "", "model")
+	f.StringVar(&c.model, "model", "", "")
+	f.Var(&c.file, "file", "a file")
+}
+
+func (c *completingCommand) Init(args []string) error {
+	return nil
+}
+
+func (c *completingCommand) Run(ctx *cmd.Context) error {
+	return nil
+}
+
+func (c *completingCommand) Complete(ctx *cmd.Context, args []string, partial string) ([]string, error) {
+	c.called = append(c.called, strings.Join(args, " "))
+	return []string{c.model + "/0", c.model + "/1", "other/0"}, nil
+}
+
+func (c *completingCommand) CompleteFlag(ctx *cmd.Context, name, partial string) ([]string, error) {
+	return []string{name + "-one", name + "-two"}, nil
+}
+
+func (s *CompletionSuite) assertCandidates(c *gc.C, sc *cmd.SuperCommand, dir string, args []string, expected ...string) {
+	c.Logf("completing %q", args)
+	// Each run starts logging afresh.
+	loggo.ResetWriters()
+	ctx, err := cmdtesting.RunCommandInDir(c, sc, append([]string{"__complete"}, args...), dir)
+	c.Assert(err, jc.ErrorIsNil)
+	var candidates []string
+	if out := cmdtesting.Stdout(ctx); out != "" {
+		candidates = strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	}
+	c.Check(candidates, jc.DeepEquals, expected)
+}
+
+func (s *CompletionSuite) TestDynamic(c *gc.C) {
+	dir := c.MkDir()
+	for _, name := range []string{"alpha.yaml", "beta.yaml", ".hidden", "adir/inner.yaml"} {
+		err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		c.Assert(err, jc.ErrorIsNil)
+		err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0644)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	sc := newTestSuper(aliasedParams(c))
+	deploy := &completingCommand{}
+	sc.Register(deploy)
+	sc.RegisterHidden(&TestCommand{Name: "debug-state"})
+
+	s.assertCandidates(c, sc, dir, []string{"de"}, "def", "defen", "defenestrate", "deploy")
+	s.assertCandidates(c, sc, dir, []string{"--debug", "b"}, "bar", "bar-foo")
+	s.assertCandidates(c, sc, dir, []string{"--q"}, "--quiet")
+	s.assertCandidates(c, sc, dir, []string{"bar", ""}, "foo", "help")
+	s.assertCandidates(c, sc, dir, []string{"deploy", "--m"}, "--model")
+	s.assertCandidates(c, sc, dir, []string{"deploy", "-m", "mysql", "unit", "my"}, "mysql/0", "mysql/1")
+	c.Check(deploy.called, jc.DeepEquals, []string{"unit"})
+	s.assertCandidates(c, sc, dir, []string{"deploy", "--model", ""}, "model-one", "model-two")
+	s.assertCandidates(c, sc, dir, []string{"deploy", "--model=model-o"}, "--model=model-one")
+	s.assertCandidates(c, sc, dir, []string{"deploy", "--file", ""}, "adir/", "alpha.yaml", "beta.yaml")
+	s.assertCandidates(c, sc, dir, []string{"deploy", "--file", "a"}, "adir/", "alpha.yaml")
+	s.assertCandidates(c, sc, dir, []string{"deploy", "--file", "adir/"}, "adir/inner.yaml")
+	s.assertCandidates(c, sc, dir, []string{"deploy", "--file", "."}, ".hidden")
+	s.assertCandidates(c, sc, dir, []string{"deploy", "--file=b"}, "--file=beta.yaml")
+	// Commands that do not complete their args offer nothing.
+	s.assertCandidates(c, sc, dir, []string{"bar", "foo", ""})
+	s.assertCandidates(c, sc, dir, []string{"missing", ""})
+}
+
+func (s *CompletionSuite) TestDynamicHidden(c *gc.C) {
+	sc := newTestSuper(aliasedParams(c))
+	c.Check(sc.Info().Doc, gc.Not(jc.Contains), "__complete")
+	c.Check(cmdtesting.InitCommand(sc, []string{"help", "__complete"}), jc.ErrorIsNil)
+
+	plain := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	_, err := cmdtesting.RunCommand(c, plain, "__complete", "")
+	c.Assert(err, gc.ErrorMatches, "unrecognized command: jujutest __complete")
+}
@@ -0,0 +1,263 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	goyaml "gopkg.in/yaml.v2"
+	"launchpad.net/gnuflag"
+)
+
+// ConfigFiles names the YAML files that set default values for the flags
+// of a SuperCommand and its subcommands. Each file maps keys of the form
+// "command.subcommand.flag", relative to the SuperCommand, onto values;
+// keys may also be written as nested mappings. A key without a command,
+// such as "debug", applies to every command. For example:
+//
+//	debug: true
+//	status:
+//	  format: json
+//	model.config.format: yaml
+//
+// The files are read in order, and values in later files replace those
+// with the same key in earlier ones. The most specific key for a flag is
+// used, whichever file it is in. Flags given on the command line, or set
+// from the environment, take precedence over the files.
+type ConfigFiles struct {
+	// System holds the path of the system-wide file.
+	System string
+
+	// User holds the path of the user's file. A leading "~/" is
+	// replaced with the user's home directory.
+	User string
+
+	// Project holds the name of the project's file, which is looked
+	// for in Context.Dir and then in each of its parents.
+	Project string
+}
+
+// configFlagName names the flag that chooses a configuration file to
+// use instead of ConfigFiles.
+const configFlagName = "config"
+
+// flagConfig holds the flag values read from configuration files.
+type flagConfig struct {
+	values map[string]configValue
+}
+
+// configValue holds the value for one key in a configuration file.
+type configValue struct {
+	// values holds the strings that the flag is set to, in order;
+	// more than one is only given when the file holds a list.
+	values []string
+	source string
+}
+
+// loadFlagConfig reads the configuration files, or only the file at
+// override if that is not empty. Missing files in files are ignored.
+func loadFlagConfig(ctx *Context, files ConfigFiles, override string) (*flagConfig, error) {
+	config := &flagConfig{values: make(map[string]configValue)}
+	if override != "" {
+		return config, config.read(ctx.AbsPath(override))
+	}
+	var paths []string
+	if files.System != "" {
+		paths = append(paths, files.System)
+	}
+	if path := files.User; path != "" {
+		if strings.HasPrefix(path, "~/") {
+			home := ctx.Getenv("HOME")
+			if home == "" {
+				path = ""
+			} else {
+				path = filepath.Join(home, path[2:])
+			}
+		}
+		if path != "" {
+			paths = append(paths, ctx.AbsPath(path))
+		}
+	}
+	if files.Project != "" {
+		if path := findProjectFile(ctx.Dir, files.Project); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	for _, path := range paths {
+		if err := config.read(path); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return config, nil
+}
+
+// findProjectFile returns the path of the named file in dir or the
+// closest of its parents, or "" if there is none.
+func findProjectFile(dir, name string) string {
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// read adds the values in the file at path to config.
+func (config *flagConfig) read(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc map[string]interface{}
+	if err := goyaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("cannot parse config file %q: %v", path, err)
+	}
+	values := make(map[string]configValue)
+	if err := flattenConfig("", doc, path, values); err != nil {
+		return fmt.Errorf("invalid config file %q: %v", path, err)
+	}
+	for key, value := range values {
+		config.values[key] = value
+	}
+	return nil
+}
+
+// flattenConfig adds the values in doc to values, keyed by their dotted
+// paths beneath prefix.
+func flattenConfig(prefix string, doc interface{}, source string, values map[string]configValue) error {
+	switch doc := doc.(type) {
+	case map[string]interface{}:
+		for key, value := range doc {
+			if err := flattenConfig(prefix+key+".", value, source, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	case map[interface{}]interface{}:
+		for key, value := range doc {
+			if err := flattenConfig(prefix+fmt.Sprint(key)+".", value, source, values); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	key := strings.TrimSuffix(prefix, ".")
+	value := configValue{source: source}
+	switch doc := doc.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		for _, item := range doc {
+			switch item.(type) {
+			case map[interface{}]interface{}, []interface{}:
+				return fmt.Errorf("%s: list items must be scalars", key)
+			}
+			value.values = append(value.values, fmt.Sprint(item))
+		}
+	default:
+		value.values = []string{fmt.Sprint(doc)}
+	}
+	values[key] = value
+	return nil
+}
+
+// set sets flag to the value, which was found under key.
+func (value configValue) set(flag *gnuflag.Flag, key string) error {
+	for _, v := range value.values {
+		if err := flag.Value.Set(v); err != nil {
+			return fmt.Errorf("invalid value %q for flag --%s from %s in %q: %v", v, flag.Name, key, value.source, err)
+		}
+	}
+	return nil
+}
+
+// lookup returns the value for the named flag of the command with the
+// given path, along with the key that it was found under, using the most
+// specific key that is present.
+func (config *flagConfig) lookup(path []string, name string) (configValue, string, bool) {
+	for i := len(path); i >= 0; i-- {
+		key := strings.Join(append(path[:i:i], name), ".")
+		if value, ok := config.values[key]; ok {
+			return value, key, true
+		}
+	}
+	return configValue{}, "", false
+}
+
+// setFlags sets each flag in f that has not already been given a value
+// from the configuration for the command with the given path.
+func (config *flagConfig) setFlags(f *gnuflag.FlagSet, path []string, given map[gnuflag.Value]bool) error {
+	var flags []*gnuflag.Flag
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		flags = append(flags, flag)
+	})
+	sort.Sort(flagsByName(flags))
+	for _, flag := range flags {
+		if given[flag.Value] || flag.Name == configFlagName {
+			continue
+		}
+		value, key, ok := config.lookup(path, flag.Name)
+		if !ok {
+			continue
+		}
+		if err := value.set(flag, key); err != nil {
+			return err
+		}
+		given[flag.Value] = true
+	}
+	return nil
+}
+
+// describe sets the flags in f from the configuration, as setFlags does,
+// and changes their documented defaults to show the values and where
+// they came from.
+func (config *flagConfig) describe(f *gnuflag.FlagSet, path []string) {
+	notes := make(map[gnuflag.Value]string)
+	var flags []*gnuflag.Flag
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		flags = append(flags, flag)
+	})
+	sort.Sort(flagsByName(flags))
+	for _, flag := range flags {
+		if _, done := notes[flag.Value]; done || flag.Name == configFlagName {
+			continue
+		}
+		value, key, ok := config.lookup(path, flag.Name)
+		if !ok {
+			continue
+		}
+		if err := value.set(flag, key); err != nil {
+			continue
+		}
+		notes[flag.Value] = fmt.Sprintf("(set by %s in %s)", key, value.source)
+	}
+	for _, flag := range flags {
+		note, ok := notes[flag.Value]
+		if !ok {
+			continue
+		}
+		flag.DefValue = flag.Value.String()
+		if flag.Usage == "" {
+			flag.Usage = note
+		} else {
+			flag.Usage += " " + note
+		}
+	}
+}
+
+type flagsByName []*gnuflag.Flag
+
+func (f flagsByName) Len() int           { return len(f) }
+func (f flagsByName) Less(i, j int) bool { return f[i].Name < f[j].Name }
+func (f flagsByName) Swap(i, j int)      { f[i], f[j] = f[j], f[i] }
@@ -0,0 +1,168 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type ConfigSuite struct {
+	gitjujutesting.IsolationSuite
+	system  string
+	home    string
+	project string
+	dir     string
+	params  cmd.SuperCommandParams
+}
+
+var _ = gc.Suite(&ConfigSuite{})
+
+func (s *ConfigSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	root := c.MkDir()
+	s.system = filepath.Join(root, "system.yaml")
+	s.home = filepath.Join(root, "home")
+	s.project = filepath.Join(root, "project")
+	s.dir = filepath.Join(s.project, "src", "pkg")
+	s.params = cmd.SuperCommandParams{
+		Name:          "jujutest",
+		FlagEnvPrefix: "JUJU_",
+		ConfigFiles: &cmd.ConfigFiles{
+			System:  s.system,
+			User:    "~/.jujutest.yaml",
+			Project: ".jujutest.yaml",
+		},
+	}
+	for _, dir := range []string{s.home, s.dir} {
+		err := os.MkdirAll(dir, 0755)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	s.write(c, s.system, "option: system\nenv:\n  count: 2\n")
+	s.write(c, filepath.Join(s.home, ".jujutest.yaml"), "blah.option: user\nsub:\n  blah:\n    option: nested\n")
+	s.write(c, filepath.Join(s.project, ".jujutest.yaml"), "option: project\n")
+}
+
+func (s *ConfigSuite) write(c *gc.C, path, content string) {
+	err := ioutil.WriteFile(path, []byte(content), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+// context returns a Context in the project directory, with $HOME set
+// to the user's home directory.
+func (s *ConfigSuite) context(c *gc.C) *cmd.Context {
+	ctx := cmdtesting.ContextForDir(c, s.dir)
+	ctx.Setenv("HOME", s.home)
+	return ctx
+}
+
+func (s *ConfigSuite) TestPrecedence(c *gc.C) {
+	s.write(c, filepath.Join(s.dir, "other.yaml"), "option: other\n")
+	for i, t := range []struct {
+		about  string
+		env    map[string]string
+		args   []string
+		output string
+	}{{
+		about:  "the most specific key is used",
+		args:   []string{"blah"},
+		output: "user\n",
+	}, {
+		about:  "later files replace earlier ones",
+		args:   []string{"env"},
+		output: "project 2\n",
+	}, {
+		about:  "nested commands",
+		args:   []string{"sub", "blah"},
+		output: "nested\n",
+	}, {
+		about:  "nested commands use less specific keys",
+		args:   []string{"sub", "other"},
+		output: "project\n",
+	}, {
+		about:  "the environment takes precedence",
+		env:    map[string]string{"JUJU_OPTION": "env"},
+		args:   []string{"blah"},
+		output: "env\n",
+	}, {
+		about:  "the command line takes precedence",
+		env:    map[string]string{"JUJU_OPTION": "env"},
+		args:   []string{"blah", "--option", "arg"},
+		output: "arg\n",
+	}, {
+		about:  "--config replaces the files",
+		args:   []string{"--config", "other.yaml", "env"},
+		output: "other 1\n",
+	}, {
+		about:  "the environment can choose the file",
+		env:    map[string]string{"JUJU_CONFIG": "other.yaml"},
+		args:   []string{"env"},
+		output: "other 1\n",
+	}, {
+		about:  "--config after the command",
+		args:   []string{"blah", "--config", "other.yaml"},
+		output: "other\n",
+	}} {
+		c.Logf("test %d: %s", i, t.about)
+		code, stdout, stderr := runMain(s.context(c), newEnvSuper(s.params, nil), t.env, t.args...)
+		c.Check(code, gc.Equals, 0)
+		c.Check(stdout, gc.Equals, t.output)
+		c.Check(stderr, gc.Equals, "")
+	}
+}
+
+func (s *ConfigSuite) TestMissingFiles(c *gc.C) {
+	err := os.Remove(s.system)
+	c.Assert(err, jc.ErrorIsNil)
+	code, stdout, _ := runMain(s.context(c), newEnvSuper(s.params, nil), map[string]string{"HOME": ""}, "env")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, gc.Equals, "project 1\n")
+
+	code, _, stderr := runMain(s.context(c), newEnvSuper(s.params, nil), nil, "--config", "missing.yaml", "env")
+	c.Check(code, gc.Equals, 2)
+	c.Check(stderr, gc.Matches, "error: open .*missing.yaml: no such file or directory\n")
+}
+
+func (s *ConfigSuite) TestInvalidFiles(c *gc.C) {
+	s.write(c, s.system, "option: [\n")
+	code, _, stderr := runMain(s.context(c), newEnvSuper(s.params, nil), nil, "env")
+	c.Check(code, gc.Equals, 2)
+	c.Check(stderr, gc.Matches, `error: cannot parse config file ".*system.yaml": .*\n`)
+
+	s.write(c, s.system, "option:\n- [a]\n")
+	code, _, stderr = runMain(s.context(c), newEnvSuper(s.params, nil), nil, "env")
+	c.Check(code, gc.Equals, 2)
+	c.Check(stderr, gc.Matches, `error: invalid config file ".*system.yaml": option: list items must be scalars\n`)
+
+	s.write(c, s.system, "env.count: many\n")
+	code, _, stderr = runMain(s.context(c), newEnvSuper(s.params, nil), nil, "env")
+	c.Check(code, gc.Equals, 2)
+	c.Check(stderr, gc.Matches, `error: invalid value "many" for flag --count from env.count in ".*system.yaml": .*\n`)
+}
+
+func (s *ConfigSuite) TestHelp(c *gc.C) {
+	code, stdout, _ := runMain(s.context(c), newEnvSuper(s.params, nil), nil, "help", "env")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, jc.Contains, "Options:\n"+
+		"-n, --count (= 2)\n"+
+		"    count-doc (set by env.count in "+s.system+") (env: $JUJU_COUNT)\n"+
+		"--option (= \"project\")\n"+
+		"    option-doc (set by option in "+filepath.Join(s.project, ".jujutest.yaml")+") (env: $JUJU_OPTION)\n")
+
+	code, stdout, _ = runMain(s.context(c), newEnvSuper(s.params, nil), nil, "sub", "blah", "--help")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, jc.Contains, "--option (= \"nested\")\n    option-doc (set by sub.blah.option in "+filepath.Join(s.home, ".jujutest.yaml")+")")
+
+	code, stdout, _ = runMain(s.context(c), newEnvSuper(s.params, nil), nil, "help", "global-options")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, jc.Contains, "--config (= \"\")\n    Specify a configuration file to read option defaults from, instead of the usual files (env: $JUJU_CONFIG)\n")
+}
@@ -0,0 +1,501 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// docFormats holds the functions that create a formatter for each
+// supported documentation format.
+var docFormats = map[string]func() docFormatter{
+	"markdown": func() docFormatter { return &markdownFormatter{} },
+	"html":     func() docFormatter { return &htmlFormatter{} },
+}
+
+// docFormatter renders a documentation page. Inline text passed to
+// its methods must already be escaped, with escape, or formatted, with
+// link or code.
+type docFormatter interface {
+	// ext returns the file extension for pages.
+	ext() string
+	escape(s string) string
+	link(text, href string) string
+	code(s string) string
+	strong(text string) string
+	begin(title string)
+	heading(level int, text string)
+	paragraph(text string)
+	preformatted(text string)
+	list(items []string)
+	table(header []string, rows [][]string)
+	bytes() []byte
+}
+
+// DocPage holds a rendered documentation page.
+type DocPage struct {
+	// Name is the name of the page, e.g. "juju-bootstrap".
+	Name string
+
+	// Filename is the name of the file for the page. Pages link to
+	// each other by file name, so they should be written to the same
+	// directory.
+	Filename string
+
+	// Content holds the rendered page.
+	Content []byte
+}
+
+// Docs returns a documentation page for c, for each command registered
+// beneath it and for each help topic added with AddHelpTopic, rendered
+// in the named format ("markdown" or "html"). Aliases and deprecated
+// commands are described in the pages of the commands they belong to.
+func (c *SuperCommand) Docs(format string) ([]DocPage, error) {
+	newFormatter, ok := docFormats[format]
+	if !ok {
+		return nil, fmt.Errorf("unsupported documentation format %q", format)
+	}
+	root := c.commandTree(true)
+	var pages []DocPage
+	root.walk(func(node *commandNode) {
+		f := newFormatter()
+		writeCommandDoc(f, root, node)
+		pages = append(pages, DocPage{
+			Name:     docPageName(node.name()),
+			Filename: docPageName(node.name()) + f.ext(),
+			Content:  f.bytes(),
+		})
+	})
+	for _, topic := range root.topics {
+		f := newFormatter()
+		writeTopicDoc(f, root, topic)
+		name := docTopicPageName(root, topic.name)
+		pages = append(pages, DocPage{
+			Name:     name,
+			Filename: name + f.ext(),
+			Content:  f.bytes(),
+		})
+	}
+	return pages, nil
+}
+
+// WriteDocs writes the pages returned by Docs into dir.
+func (c *SuperCommand) WriteDocs(dir, format string) error {
+	pages, err := c.Docs(format)
+	if err != nil {
+		return err
+	}
+	for _, page := range pages {
+		if err := ioutil.WriteFile(filepath.Join(dir, page.Filename), page.Content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// docPageName returns the name of the page for the command with the
+// given full name.
+func docPageName(name string) string {
+	return strings.Replace(name, " ", "-", -1)
+}
+
+// docTopicPageName returns the name of the page for the named help
+// topic.
+func docTopicPageName(root *commandNode, name string) string {
+	return docPageName(root.name() + " help " + name)
+}
+
+// commandLink returns a link to the page for node, titled with the last
+// part of its name unless full is true.
+func commandLink(f docFormatter, node *commandNode, full bool) string {
+	text := node.path[len(node.path)-1]
+	if full {
+		text = node.name()
+	}
+	return f.link(text, docPageName(node.name())+f.ext())
+}
+
+// deprecationNotice returns the notice for a deprecated command or
+// alias that should be replaced with replacement.
+func deprecationNotice(f docFormatter, replacement string) string {
+	if replacement == "" {
+		return f.escape("Deprecated.")
+	}
+	return f.escape("Deprecated, use ") + f.code(replacement) + f.escape(" instead.")
+}
+
+func writeCommandDoc(f docFormatter, root, node *commandNode) {
+	f.begin(node.name())
+	f.heading(1, f.escape(node.name()))
+	if node.deprecated {
+		f.paragraph(f.strong(deprecationNotice(f, node.replacement)))
+	}
+	if purpose := strings.TrimSpace(node.info.Purpose); purpose != "" {
+		f.paragraph(f.escape(purpose))
+	}
+
+	f.heading(2, f.escape("Usage"))
+	f.preformatted(node.usage)
+
+	doc, seeAlso := splitSeeAlso(node.info.Doc)
+	if doc != "" {
+		f.heading(2, f.escape("Details"))
+		writeDocText(f, doc)
+	}
+
+	if len(node.flags) > 0 {
+		f.heading(2, f.escape("Options"))
+		var rows [][]string
+		for _, flag := range node.flags {
+			var names []string
+			for _, name := range flag.names {
+				names = append(names, f.code(name))
+			}
+			defValue := ""
+			if !flag.isBool && flag.defValue != "" {
+				defValue = f.code(flag.defValue)
+			}
+			rows = append(rows, []string{strings.Join(names, ", "), defValue, f.escape(flag.usage)})
+		}
+		f.table([]string{"Flag", "Default", "Description"}, rows)
+	}
+
+	if len(node.subcmds) > 0 || len(node.aliasEntries) > 0 {
+		f.heading(2, f.escape("Commands"))
+		var names []string
+		entries := make(map[string][]string)
+		for _, child := range node.subcmds {
+			description := f.escape(firstLine(child.info.Purpose))
+			if child.deprecated {
+				description = strings.TrimSpace(deprecationNotice(f, child.replacement) + " " + description)
+			}
+			name := child.path[len(child.path)-1]
+			names = append(names, name)
+			entries[name] = []string{commandLink(f, child, false), description}
+		}
+		for _, alias := range node.aliasEntries {
+			name := alias.name[len(node.name())+1:]
+			description := f.escape("Alias for ") + f.code(alias.target[len(root.name())+1:]) + f.escape(".")
+			if alias.userArgs != nil {
+				description = f.escape("Alias for ") + f.code(strings.Join(alias.userArgs, " ")) + f.escape(".")
+				if alias.description != "" {
+					description = f.escape(alias.description)
+				}
+			}
+			if alias.deprecated {
+				description = deprecationNotice(f, alias.replacement) + " " + description
+			}
+			text := f.escape(name)
+			if target := root.lookup(alias.target); target != nil {
+				text = f.link(name, docPageName(target.name())+f.ext())
+			}
+			names = append(names, name)
+			entries[name] = []string{text, description}
+		}
+		sort.Strings(names)
+		var rows [][]string
+		for _, name := range names {
+			rows = append(rows, entries[name])
+		}
+		f.table([]string{"Command", "Description"}, rows)
+	}
+
+	if len(node.aliases) > 0 {
+		f.heading(2, f.escape("Aliases"))
+		var items []string
+		for _, alias := range node.aliases {
+			item := f.code(alias.name)
+			if alias.deprecated {
+				item += " " + deprecationNotice(f, alias.replacement)
+			}
+			items = append(items, item)
+		}
+		f.list(items)
+	}
+
+	if node == root && len(root.topics) > 0 {
+		f.heading(2, f.escape("Help topics"))
+		var rows [][]string
+		for _, topic := range root.topics {
+			rows = append(rows, []string{
+				f.link(topic.name, docTopicPageName(root, topic.name)+f.ext()),
+				f.escape(topic.short),
+			})
+		}
+		f.table([]string{"Topic", "Description"}, rows)
+	}
+
+	var links []string
+	if len(node.path) > 1 {
+		links = append(links, commandLink(f, root.lookup(strings.Join(node.path[:len(node.path)-1], " ")), true))
+	}
+	links = append(links, resolveSeeAlso(f, root, node, seeAlso)...)
+	if len(links) > 0 {
+		f.heading(2, f.escape("See also"))
+		f.list(links)
+	}
+}
+
+func writeTopicDoc(f docFormatter, root *commandNode, topic docTopic) {
+	title := root.name() + " help " + topic.name
+	f.begin(title)
+	f.heading(1, f.escape(title))
+	f.paragraph(f.escape(topic.short))
+	doc, seeAlso := splitSeeAlso(topic.long)
+	writeDocText(f, doc)
+	links := append([]string{commandLink(f, root, true)}, resolveSeeAlso(f, root, root, seeAlso)...)
+	f.heading(2, f.escape("See also"))
+	f.list(links)
+}
+
+var seeAlsoPattern = regexp.MustCompile(`(?im)^see also:`)
+
+// splitSeeAlso separates a "See also:" section, which lists commands
+// or help topics separated by commas or white space, from the end of
+// doc. It returns the rest of doc and the names that were listed.
+func splitSeeAlso(doc string) (string, []string) {
+	doc = strings.TrimSpace(doc)
+	loc := seeAlsoPattern.FindStringIndex(doc)
+	if loc == nil {
+		return doc, nil
+	}
+	section := doc[loc[1]:]
+	if i := strings.Index(section, "\n\n"); i >= 0 {
+		// Only the paragraph that starts with "See also:" is a list
+		// of references.
+		return doc, nil
+	}
+	names := strings.FieldsFunc(section, func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\t' || r == '\n'
+	})
+	return strings.TrimSpace(doc[:loc[0]]), names
+}
+
+// resolveSeeAlso returns links for the names referenced by node's
+// documentation. Names are looked for among node's siblings, then the
+// commands of root and then the help topics.
+func resolveSeeAlso(f docFormatter, root, node *commandNode, names []string) []string {
+	var links []string
+	for _, name := range names {
+		var target *commandNode
+		if len(node.path) > 1 {
+			target = root.lookup(strings.Join(node.path[:len(node.path)-1], " ") + " " + name)
+		}
+		if target == nil {
+			target = root.lookup(root.name() + " " + name)
+		}
+		if target != nil {
+			links = append(links, commandLink(f, target, true))
+			continue
+		}
+		link := f.code(name)
+		for _, topic := range root.topics {
+			if topic.name == name {
+				link = f.link(root.name()+" help "+name, docTopicPageName(root, name)+f.ext())
+				break
+			}
+		}
+		links = append(links, link)
+	}
+	return links
+}
+
+// writeDocText writes text as paragraphs. Blank lines separate
+// paragraphs, and indented lines are written as preformatted text so
+// that lists and examples keep their layout.
+func writeDocText(f docFormatter, text string) {
+	var lines []string
+	pre := false
+	flush := func() {
+		if len(lines) == 0 {
+			return
+		}
+		if pre {
+			f.preformatted(strings.Join(lines, "\n"))
+		} else {
+			f.paragraph(f.escape(strings.Join(lines, "\n")))
+		}
+		lines = nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if !pre {
+				flush()
+			} else if len(lines) > 0 {
+				lines = append(lines, "")
+			}
+			continue
+		}
+		indented := strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+		if indented != pre {
+			for len(lines) > 0 && lines[len(lines)-1] == "" {
+				lines = lines[:len(lines)-1]
+			}
+			flush()
+			pre = indented
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	flush()
+}
+
+// markdownFormatter renders pages as Markdown.
+type markdownFormatter struct {
+	buf bytes.Buffer
+}
+
+var markdownSpecial = regexp.MustCompile("[\\\\`*_\\[\\]<>|#]")
+
+func (m *markdownFormatter) ext() string {
+	return ".md"
+}
+
+func (m *markdownFormatter) escape(s string) string {
+	return markdownSpecial.ReplaceAllString(s, `\$0`)
+}
+
+func (m *markdownFormatter) link(text, href string) string {
+	return "[" + m.escape(text) + "](" + href + ")"
+}
+
+func (m *markdownFormatter) code(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		s = " " + s + " "
+	}
+	return fence + s + fence
+}
+
+func (m *markdownFormatter) strong(text string) string {
+	return "**" + text + "**"
+}
+
+func (m *markdownFormatter) begin(title string) {}
+
+func (m *markdownFormatter) separate() {
+	if m.buf.Len() > 0 {
+		m.buf.WriteString("\n")
+	}
+}
+
+func (m *markdownFormatter) heading(level int, text string) {
+	m.separate()
+	fmt.Fprintf(&m.buf, "%s %s\n", strings.Repeat("#", level), text)
+}
+
+func (m *markdownFormatter) paragraph(text string) {
+	m.separate()
+	fmt.Fprintf(&m.buf, "%s\n", text)
+}
+
+func (m *markdownFormatter) preformatted(text string) {
+	m.separate()
+	fmt.Fprintf(&m.buf, "```\n%s\n```\n", text)
+}
+
+func (m *markdownFormatter) list(items []string) {
+	m.separate()
+	for _, item := range items {
+		fmt.Fprintf(&m.buf, "- %s\n", item)
+	}
+}
+
+func (m *markdownFormatter) table(header []string, rows [][]string) {
+	m.separate()
+	fmt.Fprintf(&m.buf, "| %s |\n", strings.Join(header, " | "))
+	fmt.Fprintf(&m.buf, "|%s\n", strings.Repeat(" --- |", len(header)))
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, cell := range row {
+			cells[i] = strings.Replace(cell, "\n", " ", -1)
+		}
+		fmt.Fprintf(&m.buf, "| %s |\n", strings.Join(cells, " | "))
+	}
+}
+
+func (m *markdownFormatter) bytes() []byte {
+	return m.buf.Bytes()
+}
+
+// htmlFormatter renders pages as HTML documents.
+type htmlFormatter struct {
+	buf bytes.Buffer
+}
+
+func (h *htmlFormatter) ext() string {
+	return ".html"
+}
+
+func (h *htmlFormatter) escape(s string) string {
+	return html.EscapeString(s)
+}
+
+func (h *htmlFormatter) link(text, href string) string {
+	return `<a href="` + html.EscapeString(href) + `">` + html.EscapeString(text) + "</a>"
+}
+
+func (h *htmlFormatter) code(s string) string {
+	return "<code>" + html.EscapeString(s) + "</code>"
+}
+
+func (h *htmlFormatter) strong(text string) string {
+	return "<strong>" + text + "</strong>"
+}
+
+func (h *htmlFormatter) begin(title string) {
+	fmt.Fprintf(&h.buf, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n</head>\n<body>\n", html.EscapeString(title))
+}
+
+func (h *htmlFormatter) heading(level int, text string) {
+	fmt.Fprintf(&h.buf, "<h%d>%s</h%d>\n", level, text, level)
+}
+
+func (h *htmlFormatter) paragraph(text string) {
+	fmt.Fprintf(&h.buf, "<p>%s</p>\n", text)
+}
+
+func (h *htmlFormatter) preformatted(text string) {
+	fmt.Fprintf(&h.buf, "<pre>%s</pre>\n", html.EscapeString(text))
+}
+
+func (h *htmlFormatter) list(items []string) {
+	fmt.Fprintf(&h.buf, "<ul>\n")
+	for _, item := range items {
+		fmt.Fprintf(&h.buf, "<li>%s</li>\n", item)
+	}
+	fmt.Fprintf(&h.buf, "</ul>\n")
+}
+
+func (h *htmlFormatter) table(header []string, rows [][]string) {
+	fmt.Fprintf(&h.buf, "<table>\n<tr>")
+	for _, cell := range header {
+		fmt.Fprintf(&h.buf, "<th>%s</th>", cell)
+	}
+	fmt.Fprintf(&h.buf, "</tr>\n")
+	for _, row := range rows {
+		fmt.Fprintf(&h.buf, "<tr>")
+		for _, cell := range row {
+			fmt.Fprintf(&h.buf, "<td>%s</td>", cell)
+		}
+		fmt.Fprintf(&h.buf, "</tr>\n")
+	}
+	fmt.Fprintf(&h.buf, "</table>\n")
+}
+
+func (h *htmlFormatter) bytes() []byte {
+	return append(h.buf.Bytes(), "</body>\n</html>\n"...)
+}
@@ -0,0 +1,179 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+)
+
+type DocsSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&DocsSuite{})
+
+// docsParams holds the parameters of the SuperCommands that the
+// documentation tests describe.
+var docsParams = cmd.SuperCommandParams{
+	Name:    "jujutest",
+	Purpose: "test docs",
+	Doc:     "Jujutest does *things*.\n\nSee also: concepts, bar",
+}
+
+func (s *DocsSuite) docs(c *gc.C, format string) map[string]string {
+	pages, err := newTestSuper(docsParams).Docs(format)
+	c.Assert(err, jc.ErrorIsNil)
+	docs := make(map[string]string)
+	for _, page := range pages {
+		docs[page.Filename] = string(page.Content)
+	}
+	return docs
+}
+
+func (s *DocsSuite) TestPages(c *gc.C) {
+	pages, err := newTestSuper(docsParams).Docs("markdown")
+	c.Assert(err, jc.ErrorIsNil)
+	var names []string
+	for _, page := range pages {
+		c.Check(page.Filename, gc.Equals, page.Name+".md")
+		names = append(names, page.Name)
+	}
+	c.Assert(names, jc.DeepEquals, []string{
+		"jujutest",
+		"jujutest-bar",
+		"jujutest-bar-foo",
+		"jujutest-bar-help",
+		"jujutest-defenestrate",
+		"jujutest-help",
+		"jujutest-old",
+		"jujutest-help-concepts",
+	})
+}
+
+func (s *DocsSuite) TestUnsupportedFormat(c *gc.C) {
+	_, err := newTestSuper(docsParams).Docs("pdf")
+	c.Assert(err, gc.ErrorMatches, `unsupported documentation format "pdf"`)
+}
+
+func (s *DocsSuite) TestMarkdown(c *gc.C) {
+	docs := s.docs(c, "markdown")
+	c.Check(docs["jujutest.md"], gc.Equals, "# jujutest\n"+`
+test docs
+
+## Usage
+
+`+"```"+`
+Usage: jujutest [options] <command> ...
+`+"```"+`
+
+## Details
+
+Jujutest does \*things\*.
+
+## Options
+
+| Flag | Default | Description |
+| --- | --- | --- |
+| `+"`--description`"+` |  |  |
+| `+"`-h`, `--help`"+` |  | show help on a command or other topic |
+
+## Commands
+
+| Command | Description |
+| --- | --- |
+| [bar](jujutest-bar.md) | bar functions |
+| [bar-foo](jujutest-bar-foo.md) | Alias for `+"`bar foo`"+`. |
+| [defen](jujutest-defenestrate.md) | Alias for `+"`defenestrate`"+`. |
+| [defenestrate](jujutest-defenestrate.md) | defenestrate the juju |
+| [help](jujutest-help.md) | show help on a command or other topic |
+| [old](jujutest-old.md) | Deprecated, use `+"`defenestrate`"+` instead. to be simple |
+| [old-throw](jujutest-defenestrate.md) | Deprecated, use `+"`throw`"+` instead. Alias for `+"`defenestrate`"+`. |
+| [throw](jujutest-defenestrate.md) | Alias for `+"`defenestrate`"+`. |
+
+## Help topics
+
+| Topic | Description |
+| --- | --- |
+| [concepts](jujutest-help-concepts.md) | Basic concepts |
+
+## See also
+
+- [jujutest help concepts](jujutest-help-concepts.md)
+- [jujutest bar](jujutest-bar.md)
+`)
+	c.Check(docs["jujutest-defenestrate.md"], jc.Contains, `
+## Options
+
+| Flag | Default | Description |
+| --- | --- | --- |
+| `+"`--description`"+` |  |  |
+| `+"`-h`, `--help`"+` |  | show help on a command or other topic |
+| `+"`--option`"+` |  | option-doc |
+
+## Aliases
+
+- `+"`jujutest defen`"+`
+- `+"`jujutest old-throw`"+` Deprecated, use `+"`throw`"+` instead.
+- `+"`jujutest throw`"+`
+
+## See also
+
+- [jujutest](jujutest.md)
+`)
+	c.Check(docs["jujutest-old.md"], jc.HasPrefix, "# jujutest old\n\n**Deprecated, use `defenestrate` instead.**\n")
+	c.Check(docs["jujutest-bar-foo.md"], jc.Contains, "## Aliases\n\n- `jujutest bar-foo`\n")
+	c.Check(docs["jujutest-help-concepts.md"], gc.Equals, `# jujutest help concepts
+
+Basic concepts
+
+Try jujutest defenestrate.
+
+## See also
+
+- [jujutest](jujutest.md)
+- [jujutest defenestrate](jujutest-defenestrate.md)
+- `+"`topics`"+`
+`)
+}
+
+func (s *DocsSuite) TestHTML(c *gc.C) {
+	docs := s.docs(c, "html")
+	page := docs["jujutest-defenestrate.html"]
+	c.Check(page, jc.HasPrefix, `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>jujutest defenestrate</title>
+</head>
+<body>
+<h1>jujutest defenestrate</h1>
+<p>defenestrate the juju</p>
+<h2>Usage</h2>
+<pre>Usage: jujutest defenestrate [options] &lt;something&gt;</pre>
+<h2>Details</h2>
+<p>defenestrate-doc</p>
+<h2>Options</h2>
+<table>
+<tr><th>Flag</th><th>Default</th><th>Description</th></tr>
+`)
+	c.Check(page, jc.Contains, "<li><code>jujutest old-throw</code> Deprecated, use <code>throw</code> instead.</li>\n")
+	c.Check(page, jc.HasSuffix, "<h2>See also</h2>\n<ul>\n<li><a href=\"jujutest.html\">jujutest</a></li>\n</ul>\n</body>\n</html>\n")
+	c.Check(docs["jujutest.html"], jc.Contains, `<tr><td><a href="jujutest-help-concepts.html">concepts</a></td><td>Basic concepts</td></tr>`)
+}
+
+func (s *DocsSuite) TestWriteDocs(c *gc.C) {
+	dir := c.MkDir()
+	err := newTestSuper(docsParams).WriteDocs(dir, "html")
+	c.Assert(err, jc.ErrorIsNil)
+	content, err := ioutil.ReadFile(filepath.Join(dir, "jujutest-bar-foo.html"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(content), jc.Contains, "<h1>jujutest bar foo</h1>\n")
+}
@@ -0,0 +1,83 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+)
+
+// errorFormatters holds the formatters that can be specified with the
+// --error-format flag.
+var errorFormatters = map[string]Formatter{
+	"text": formatErrorText,
+	"yaml": FormatYaml,
+	"json": FormatJson,
+}
+
+// errorDocument is the machine-readable description of a failed command
+// that is written to stderr when --error-format is json or yaml.
+type errorDocument struct {
+	Message string `json:"message" yaml:"message"`
+	Type    string `json:"type" yaml:"type"`
+	Code    int    `json:"code" yaml:"code"`
+	Command string `json:"command" yaml:"command"`
+	Details string `json:"details" yaml:"details"`
+}
+
+// formatErrorText formats an errorDocument the way Main reports errors
+// by default.
+func formatErrorText(value interface{}) ([]byte, error) {
+	return []byte("error: " + value.(*errorDocument).Message), nil
+}
+
+// errorWriter is implemented by commands that control how Main reports
+// their errors.
+type errorWriter interface {
+	// writeError reports err, which makes Main exit with code, and
+	// returns whether it did so.
+	writeError(ctx *Context, err error, code int) bool
+}
+
+// writeError reports err on ctx.Stderr.
+func writeError(c Command, ctx *Context, err error, code int) {
+	if w, ok := c.(errorWriter); ok && w.writeError(ctx, err, code) {
+		return
+	}
+	fmt.Fprintf(ctx.Stderr, "error: %v\n", err)
+}
+
+// structuredErrors returns whether errors should be reported as
+// documents rather than text.
+func (c *SuperCommand) structuredErrors() bool {
+	return c.errorFormat != nil && c.errorFormat.name != "text"
+}
+
+// writeError implements errorWriter.
+func (c *SuperCommand) writeError(ctx *Context, err error, code int) bool {
+	if c.errorFormat == nil {
+		return false
+	}
+	return c.writeErrorDocument(ctx, c.Info().Name, err, code)
+}
+
+// writeErrorDocument writes err to ctx.Stderr in the chosen error
+// format, describing it as an error from the named command.
+func (c *SuperCommand) writeErrorDocument(ctx *Context, name string, err error, code int) bool {
+	doc := &errorDocument{
+		Message: err.Error(),
+		Type:    fmt.Sprintf("%T", errors.Cause(err)),
+		Code:    code,
+		Command: name,
+		Details: errors.Details(err),
+	}
+	bytes, ferr := c.errorFormat.format(doc)
+	if ferr != nil {
+		logger.Errorf("cannot format error: %v", ferr)
+		return false
+	}
+	fmt.Fprintf(ctx.Stderr, "%s\n", bytes)
+	return true
+}
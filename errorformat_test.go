@@ -0,0 +1,151 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"encoding/json"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	goyaml "gopkg.in/yaml.v2"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type ErrorFormatSuite struct {
+	gitjujutesting.LoggingSuite
+}
+
+var _ = gc.Suite(&ErrorFormatSuite{})
+
+// errorFormatParams returns the parameters of the SuperCommands that
+// the error format tests run, with --error-format enabled.
+func errorFormatParams() cmd.SuperCommandParams {
+	return cmd.SuperCommandParams{
+		Name:            "jujutest",
+		Log:             &cmd.Log{},
+		ErrorFormatFlag: true,
+	}
+}
+
+type errorDocument struct {
+	Message string
+	Type    string
+	Code    int
+	Command string
+	Details string
+}
+
+func (s *ErrorFormatSuite) TestText(c *gc.C) {
+	sc := newFailingSuper(errorFormatParams(), errors.New("BAM!"))
+	code, stdout, stderr := runMain(cmdtesting.Context(c), sc, nil, "fail")
+	c.Check(code, gc.Equals, cmd.ExitFailure)
+	c.Check(stdout, gc.Equals, "")
+	c.Check(stderr, gc.Equals, "ERROR BAM!\n")
+
+	loggo.ResetWriters()
+	sc = newFailingSuper(errorFormatParams(), nil)
+	code, stdout, stderr = runMain(cmdtesting.Context(c), sc, nil, "--error-format", "text", "fail", "--unknown")
+	c.Check(code, gc.Equals, cmd.ExitUsage)
+	c.Check(stdout, gc.Equals, "")
+	c.Check(stderr, gc.Equals, "error: flag provided but not defined: --unknown\n")
+}
+
+func (s *ErrorFormatSuite) TestJSONRunError(c *gc.C) {
+	runErr := errors.Annotate(errors.NotFoundf("machine 0"), "cannot fail")
+	params := errorFormatParams()
+	params.ErrorExitCodes = []cmd.ErrorExitCode{{Match: errors.IsNotFound, Code: 4}}
+	sc := newFailingSuper(params, runErr)
+	code, stdout, stderr := runMain(cmdtesting.Context(c), sc, nil, "--error-format", "json", "fail")
+	c.Check(code, gc.Equals, 4)
+	c.Check(stdout, gc.Equals, "")
+	var doc errorDocument
+	err := json.Unmarshal([]byte(stderr), &doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Message, gc.Equals, "cannot fail: machine 0 not found")
+	c.Check(doc.Type, gc.Equals, "*errors.notFound")
+	c.Check(doc.Code, gc.Equals, 4)
+	c.Check(doc.Command, gc.Equals, "jujutest fail")
+	c.Check(doc.Details, gc.Equals, errors.Details(runErr))
+}
+
+func (s *ErrorFormatSuite) TestYAMLInitError(c *gc.C) {
+	sc := newFailingSuper(errorFormatParams(), nil)
+	code, stdout, stderr := runMain(cmdtesting.Context(c), sc, nil, "--error-format=yaml", "bar", "fail", "--unknown")
+	c.Check(code, gc.Equals, cmd.ExitUsage)
+	c.Check(stdout, gc.Equals, "")
+	var doc errorDocument
+	err := goyaml.Unmarshal([]byte(stderr), &doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Message, gc.Equals, "flag provided but not defined: --unknown")
+	c.Check(doc.Code, gc.Equals, cmd.ExitUsage)
+	c.Check(doc.Command, gc.Equals, "jujutest bar fail")
+
+	loggo.ResetWriters()
+	sc = newFailingSuper(errorFormatParams(), nil)
+	code, stdout, stderr = runMain(cmdtesting.Context(c), sc, nil, "--error-format=yaml", "discombobulate")
+	c.Check(code, gc.Equals, cmd.ExitUnknownCommand)
+	c.Check(stdout, gc.Equals, "")
+	err = goyaml.Unmarshal([]byte(stderr), &doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Message, gc.Equals, "unrecognized command: jujutest discombobulate")
+	c.Check(doc.Type, gc.Equals, "*cmd.UnrecognizedCommand")
+	c.Check(doc.Command, gc.Equals, "jujutest")
+}
+
+func (s *ErrorFormatSuite) TestNested(c *gc.C) {
+	// The format chosen for the outer command applies to nested ones.
+	sc := newFailingSuper(errorFormatParams(), errors.New("BAM!"))
+	code, stdout, stderr := runMain(cmdtesting.Context(c), sc, nil, "--error-format", "json", "bar", "fail")
+	c.Check(code, gc.Equals, cmd.ExitFailure)
+	c.Check(stdout, gc.Equals, "")
+	var doc errorDocument
+	err := json.Unmarshal([]byte(stderr), &doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Message, gc.Equals, "BAM!")
+	c.Check(doc.Command, gc.Equals, "jujutest bar fail")
+}
+
+func (s *ErrorFormatSuite) TestMissingCallbackError(c *gc.C) {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:            "jujutest",
+		Log:             &cmd.Log{},
+		ErrorFormatFlag: true,
+		MissingCallback: func(ctx *cmd.Context, subcommand string, args []string) error {
+			if subcommand == "foo" {
+				return errors.New("boom")
+			}
+			return &cmd.UnrecognizedCommand{Name: subcommand}
+		},
+	})
+	code, stdout, stderr := runMain(cmdtesting.Context(c), sc, nil, "--error-format=json", "foo")
+	c.Check(code, gc.Equals, cmd.ExitFailure)
+	c.Check(stdout, gc.Equals, "")
+	var doc errorDocument
+	err := json.Unmarshal([]byte(stderr), &doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Message, gc.Equals, "boom")
+	c.Check(doc.Command, gc.Equals, "jujutest foo")
+
+	loggo.ResetWriters()
+	code, stdout, stderr = runMain(cmdtesting.Context(c), sc, nil, "--error-format=json", "fooo")
+	c.Check(code, gc.Equals, cmd.ExitUnknownCommand)
+	c.Check(stdout, gc.Equals, "")
+	err = json.Unmarshal([]byte(stderr), &doc)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(doc.Message, gc.Equals, "unrecognized command: jujutest fooo")
+	c.Check(doc.Command, gc.Equals, "jujutest fooo")
+}
+
+func (s *ErrorFormatSuite) TestUnknownFormat(c *gc.C) {
+	sc := newFailingSuper(errorFormatParams(), nil)
+	code, stdout, stderr := runMain(cmdtesting.Context(c), sc, nil, "--error-format", "xml", "fail")
+	c.Check(code, gc.Equals, cmd.ExitUsage)
+	c.Check(stdout, gc.Equals, "")
+	c.Check(stderr, gc.Equals, `error: invalid value "xml" for flag --error-format: unknown format "xml"`+"\n")
+}
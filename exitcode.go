@@ -0,0 +1,122 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"github.com/juju/errors"
+)
+
+// These are the codes returned by Main in the built-in cases. Errors
+// can request other codes by implementing ExitCoder, and a SuperCommand
+// can map errors to codes with SuperCommandParams.ErrorExitCodes.
+const (
+	// ExitSuccess is returned when the command succeeds.
+	ExitSuccess = 0
+
+	// ExitFailure is returned when the command's Run returns an error
+	// that does not specify a code.
+	ExitFailure = 1
+
+	// ExitUsage is returned when the command line cannot be parsed,
+	// because of an unknown or malformed flag or invalid arguments.
+	ExitUsage = 2
+
+	// ExitUnknownCommand is returned when a SuperCommand does not
+	// recognise the requested subcommand, whether it is found to be
+	// missing by Init or by a MissingCallback, as a shell does when a
+	// command is not found. Before this code was introduced, commands
+	// unknown to Init exited with 2 and those unknown to a
+	// MissingCallback exited with 1.
+	ExitUnknownCommand = 127
+
+	// ExitInterrupted is returned when the command fails after being
+	// cancelled by SIGINT or SIGTERM, and when a second signal forces
+	// the process to exit.
+	ExitInterrupted = 130
+)
+
+// ExitCoder is implemented by errors that determine the code Main
+// exits with. It is honoured on errors returned by a command's Init
+// or Run, whether they are returned directly or annotated with the
+// github.com/juju/errors package.
+type ExitCoder interface {
+	ExitCode() int
+}
+
+// ErrorExitCode maps the errors for which Match returns true to Code.
+// Match is typically a predicate such as errors.IsNotFound.
+type ErrorExitCode struct {
+	Match func(error) bool
+	Code  int
+}
+
+// ExitCode implements ExitCoder.
+func (e *RcPassthroughError) ExitCode() int {
+	return e.Code
+}
+
+// ExitCode implements ExitCoder.
+func (e *UnrecognizedCommand) ExitCode() int {
+	return ExitUnknownCommand
+}
+
+// silentError is returned by SuperCommand.Run in place of an error that
+// has already been logged, so that Main exits with the error's code
+// without reporting it again.
+type silentError struct {
+	code int
+}
+
+// Error implements error.
+func (e *silentError) Error() string {
+	return ErrSilent.Error()
+}
+
+// ExitCode implements ExitCoder.
+func (e *silentError) ExitCode() int {
+	return e.code
+}
+
+// exitCodeOf returns the code requested by err, looking for an
+// ExitCoder among its annotations and then at its cause.
+func exitCodeOf(err error) (int, bool) {
+	for e := err; e != nil; {
+		if coder, ok := e.(ExitCoder); ok {
+			return coder.ExitCode(), true
+		}
+		wrapper, ok := e.(interface {
+			Underlying() error
+		})
+		if !ok {
+			break
+		}
+		e = wrapper.Underlying()
+	}
+	if coder, ok := errors.Cause(err).(ExitCoder); ok {
+		return coder.ExitCode(), true
+	}
+	return 0, false
+}
+
+// exitCode returns the code that Main should exit with when err is
+// returned by the selected subcommand.
+func (c *SuperCommand) exitCode(err error) (int, bool) {
+	if code, ok := exitCodeOf(err); ok {
+		return code, true
+	}
+	for _, mapping := range c.errorExitCodeChain() {
+		if mapping.Match(err) {
+			return mapping.Code, true
+		}
+	}
+	return 0, false
+}
+
+// errorExitCodeChain returns the mappings from errors to exit codes that
+// apply to c's subcommands: c's own, followed by those inherited from the
+// SuperCommands above c.
+func (c *SuperCommand) errorExitCodeChain() []ErrorExitCode {
+	chain := c.errorExitCodes[:len(c.errorExitCodes):len(c.errorExitCodes)]
+	return append(chain, c.parentErrorExitCodes...)
+}
@@ -0,0 +1,186 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"fmt"
+
+	"github.com/juju/errors"
+	"github.com/juju/loggo"
+	gitjujutesting "github.com/juju/testing"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type ExitCodeSuite struct {
+	gitjujutesting.LoggingSuite
+}
+
+var _ = gc.Suite(&ExitCodeSuite{})
+
+// codeError is an error that requests a specific exit code.
+type codeError int
+
+func (e codeError) Error() string {
+	return fmt.Sprintf("code %d", int(e))
+}
+
+func (e codeError) ExitCode() int {
+	return int(e)
+}
+
+// failingCommand returns its errors from Init and Run.
+type failingCommand struct {
+	cmd.CommandBase
+	initErr error
+	runErr  error
+}
+
+func (c *failingCommand) Info() *cmd.Info {
+	return &cmd.Info{Name: "fail", Purpose: "to fail"}
+}
+
+func (c *failingCommand) Init(args []string) error {
+	return c.initErr
+}
+
+func (c *failingCommand) Run(ctx *cmd.Context) error {
+	return c.runErr
+}
+
+func (s *ExitCodeSuite) TestExitCoder(c *gc.C) {
+	for i, test := range []struct {
+		command *failingCommand
+		code    int
+		stderr  string
+	}{{
+		command: &failingCommand{runErr: codeError(3)},
+		code:    3,
+		stderr:  "error: code 3\n",
+	}, {
+		command: &failingCommand{runErr: errors.Annotate(codeError(4), "annotated")},
+		code:    4,
+		stderr:  "error: annotated: code 4\n",
+	}, {
+		command: &failingCommand{runErr: errors.Wrap(errors.New("wrapped"), codeError(5))},
+		code:    5,
+		stderr:  "error: code 5\n",
+	}, {
+		command: &failingCommand{initErr: errors.Trace(codeError(6))},
+		code:    6,
+		stderr:  "error: code 6\n",
+	}, {
+		command: &failingCommand{initErr: errors.New("bad args")},
+		code:    cmd.ExitUsage,
+		stderr:  "error: bad args\n",
+	}, {
+		command: &failingCommand{runErr: errors.New("failed")},
+		code:    cmd.ExitFailure,
+		stderr:  "error: failed\n",
+	}, {
+		command: &failingCommand{runErr: cmd.NewRcPassthroughError(7)},
+		code:    7,
+	}} {
+		c.Logf("test %d", i)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(test.command, ctx, nil)
+		c.Check(code, gc.Equals, test.code)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, test.stderr)
+	}
+}
+
+func (s *ExitCodeSuite) TestUnknownCommand(c *gc.C) {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"discombobulate"})
+	c.Check(code, gc.Equals, cmd.ExitUnknownCommand)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: unrecognized command: jujutest discombobulate\n")
+
+	// Commands that a MissingCallback does not recognise exit with the
+	// same code.
+	sc = cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		MissingCallback: func(ctx *cmd.Context, subcommand string, args []string) error {
+			return &cmd.UnrecognizedCommand{Name: subcommand}
+		},
+	})
+	ctx = cmdtesting.Context(c)
+	code = cmd.Main(sc, ctx, []string{"discombobulate"})
+	c.Check(code, gc.Equals, cmd.ExitUnknownCommand)
+}
+
+func (s *ExitCodeSuite) TestErrorExitCodes(c *gc.C) {
+	newSuper := func(runErr error) *cmd.SuperCommand {
+		sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name: "jujutest",
+			Log:  &cmd.Log{},
+			ErrorExitCodes: []cmd.ErrorExitCode{
+				{Match: errors.IsNotFound, Code: 4},
+				{Match: errors.IsUnauthorized, Code: 5},
+			},
+		})
+		sc.Register(&failingCommand{runErr: runErr})
+		sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:           "bar",
+			UsagePrefix:    "jujutest",
+			ErrorExitCodes: []cmd.ErrorExitCode{{Match: errors.IsNotFound, Code: 6}},
+		})
+		sub.Register(&failingCommand{runErr: runErr})
+		sc.Register(sub)
+		return sc
+	}
+	for i, test := range []struct {
+		args   []string
+		runErr error
+		code   int
+		stderr string
+	}{{
+		args:   []string{"fail"},
+		runErr: errors.NotFoundf("machine 0"),
+		code:   4,
+		stderr: "ERROR machine 0 not found\n",
+	}, {
+		args:   []string{"fail"},
+		runErr: errors.Annotate(errors.Unauthorizedf("no access"), "listing"),
+		code:   5,
+		stderr: "ERROR listing: no access\n",
+	}, {
+		args:   []string{"fail"},
+		runErr: errors.Annotate(errors.NotFoundf("machine 0"), "a"),
+		code:   4,
+		stderr: "ERROR a: machine 0 not found\n",
+	}, {
+		args:   []string{"fail"},
+		runErr: errors.New("unmapped"),
+		code:   cmd.ExitFailure,
+		stderr: "ERROR unmapped\n",
+	}, {
+		// Errors that specify their own code are not remapped.
+		args:   []string{"fail"},
+		runErr: codeError(9),
+		code:   9,
+		stderr: "ERROR code 9\n",
+	}, {
+		// The code chosen by a nested SuperCommand is kept.
+		args:   []string{"bar", "fail"},
+		runErr: errors.NotFoundf("unit 0"),
+		code:   6,
+		stderr: "ERROR unit 0 not found\n",
+	}, {
+		// Nested SuperCommands inherit the mappings of those above.
+		args:   []string{"bar", "fail"},
+		runErr: errors.Unauthorizedf("no access"),
+		code:   5,
+		stderr: "ERROR no access\n",
+	}} {
+		c.Logf("test %d", i)
+		loggo.ResetWriters()
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(newSuper(test.runErr), ctx, test.args)
+		c.Check(code, gc.Equals, test.code)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, test.stderr)
+	}
+}
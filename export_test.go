@@ -0,0 +1,10 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+var (
+	SignalNotify = &signalNotify
+	SignalStop   = &signalStop
+	OSExit       = &osExit
+)
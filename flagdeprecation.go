@@ -0,0 +1,155 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"launchpad.net/gnuflag"
+)
+
+// FlagStatus describes how far a flag has got in being phased out.
+type FlagStatus int
+
+const (
+	// FlagDeprecated flags still work, but a warning is written when
+	// they are used, and help output notes that they are deprecated.
+	FlagDeprecated FlagStatus = iota + 1
+
+	// FlagHidden flags still work, with a warning if they have a
+	// replacement, but are left out of help output.
+	FlagHidden
+
+	// FlagObsolete flags are rejected with an error naming their
+	// replacement, and are left out of help output. Obsolete flags
+	// need not be defined.
+	FlagObsolete
+)
+
+// FlagDeprecation describes a flag that is being phased out.
+type FlagDeprecation struct {
+	Status FlagStatus
+
+	// Replacement, if not empty, holds what to use instead of the
+	// flag, e.g. "--model".
+	Replacement string
+}
+
+// message returns a description of the flag with the given name in
+// the deprecation's state.
+func (d FlagDeprecation) message(name string) string {
+	state := "deprecated"
+	if d.Status == FlagObsolete {
+		state = "obsolete"
+	}
+	msg := fmt.Sprintf("%q is %s", flagWithMinus(name), state)
+	if d.Replacement != "" {
+		msg += fmt.Sprintf(", please use %q", d.Replacement)
+	}
+	return msg
+}
+
+// mergeFlagDeprecations returns the deprecations in all of the given
+// maps, with those in later maps taking precedence.
+func mergeFlagDeprecations(maps ...map[string]FlagDeprecation) map[string]FlagDeprecation {
+	merged := make(map[string]FlagDeprecation)
+	for _, m := range maps {
+		for name, d := range m {
+			merged[name] = d
+		}
+	}
+	return merged
+}
+
+// checkFlagDeprecations returns a warning for each deprecated flag that
+// was given when the flag sets were parsed, or an error if an obsolete
+// flag was given.
+func checkFlagDeprecations(deprecations map[string]FlagDeprecation, flagSets ...*gnuflag.FlagSet) ([]string, error) {
+	if len(deprecations) == 0 {
+		return nil, nil
+	}
+	var warnings []string
+	var err error
+	seen := make(map[string]bool)
+	for _, f := range flagSets {
+		if f == nil {
+			continue
+		}
+		f.Visit(func(flag *gnuflag.Flag) {
+			d, ok := deprecations[flag.Name]
+			if !ok || seen[flag.Name] || err != nil {
+				return
+			}
+			seen[flag.Name] = true
+			switch {
+			case d.Status == FlagObsolete:
+				err = fmt.Errorf("%s", d.message(flag.Name))
+			case d.Status == FlagDeprecated || d.Replacement != "":
+				warnings = append(warnings, d.message(flag.Name))
+			}
+		})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return warnings, nil
+}
+
+// visibleFlags returns the flags in f that should be shown in help
+// output. Hidden and obsolete flags are left out, as are deprecated
+// flags that are other names for a flag that is shown; the usage of
+// other deprecated flags notes that they are deprecated.
+func visibleFlags(f *gnuflag.FlagSet, deprecations map[string]FlagDeprecation) *gnuflag.FlagSet {
+	if len(deprecations) == 0 {
+		return f
+	}
+	shown := make(map[gnuflag.Value]bool)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if _, ok := deprecations[flag.Name]; !ok {
+			shown[flag.Value] = true
+		}
+	})
+	visible := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
+	visible.SetOutput(ioutil.Discard)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		usage := flag.Usage
+		if d, ok := deprecations[flag.Name]; ok {
+			if d.Status != FlagDeprecated || shown[flag.Value] {
+				return
+			}
+			note := "(deprecated)"
+			if d.Replacement != "" {
+				note = fmt.Sprintf("(deprecated, use %s)", d.Replacement)
+			}
+			if usage == "" {
+				usage = note
+			} else {
+				usage += " " + note
+			}
+		}
+		visible.Var(flag.Value, flag.Name, usage)
+		// The default may have been described by a configuration file.
+		visible.Lookup(flag.Name).DefValue = flag.DefValue
+	})
+	return visible
+}
+
+// checkCommandFlags checks the flags of c that were given on the command
+// line when f was parsed by Main, writing a warning to ctx for each
+// deprecated flag. A SuperCommand checks its flags in Init, and writes
+// its warnings when it runs.
+func checkCommandFlags(c Command, ctx *Context, f *gnuflag.FlagSet) error {
+	if c.IsSuperCommand() {
+		return nil
+	}
+	warnings, err := checkFlagDeprecations(c.Info().FlagDeprecations, f)
+	if err != nil {
+		return err
+	}
+	for _, warning := range warnings {
+		ctx.Infof("WARNING: %s", warning)
+	}
+	return nil
+}
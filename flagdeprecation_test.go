@@ -0,0 +1,180 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"fmt"
+
+	"github.com/juju/loggo"
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type FlagDeprecationSuite struct {
+	gitjujutesting.LoggingSuite
+}
+
+var _ = gc.Suite(&FlagDeprecationSuite{})
+
+// renamedCommand has flags at each stage of being phased out.
+type renamedCommand struct {
+	cmd.CommandBase
+	model   string
+	wait    bool
+	debug   bool
+	legacy  string
+	timeout string
+}
+
+func (c *renamedCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "renamed",
+		Purpose: "print flags",
+		FlagDeprecations: map[string]cmd.FlagDeprecation{
+			"environment": {Status: cmd.FlagDeprecated, Replacement: "--model"},
+			"wait":        {Status: cmd.FlagDeprecated},
+			"debug-dump":  {Status: cmd.FlagHidden},
+			"legacy":      {Status: cmd.FlagObsolete},
+			"upload":      {Status: cmd.FlagObsolete, Replacement: "--build-agent"},
+		},
+	}
+}
+
+func (c *renamedCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&c.model, "m", "", "model to use")
+	f.StringVar(&c.model, "model", "", "")
+	f.StringVar(&c.model, "environment", "", "")
+	f.BoolVar(&c.wait, "wait", false, "wait for the result")
+	f.BoolVar(&c.debug, "debug-dump", false, "dump internal state")
+	f.StringVar(&c.legacy, "legacy", "", "legacy behaviour")
+	f.StringVar(&c.timeout, "timeout", "", "time to wait")
+}
+
+func (c *renamedCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "%s %v %v\n", c.model, c.wait, c.debug)
+	return nil
+}
+
+func (s *FlagDeprecationSuite) TestCommand(c *gc.C) {
+	for i, t := range []struct {
+		args   []string
+		code   int
+		output string
+		err    string
+	}{{
+		args:   []string{"--model", "m1"},
+		output: "m1 false false\n",
+	}, {
+		args:   []string{"--environment", "m1", "--wait"},
+		output: "m1 true false\n",
+		err:    "WARNING: \"--environment\" is deprecated, please use \"--model\"\nWARNING: \"--wait\" is deprecated\n",
+	}, {
+		args:   []string{"--debug-dump"},
+		output: " false true\n",
+	}, {
+		args: []string{"--legacy", "x"},
+		code: 2,
+		err:  "error: \"--legacy\" is obsolete\n",
+	}, {
+		args: []string{"--upload"},
+		code: 2,
+		err:  "error: \"--upload\" is obsolete, please use \"--build-agent\"\n",
+	}, {
+		args: []string{"--wiat"},
+		code: 2,
+		err:  "error: flag provided but not defined: --wiat\n",
+	}} {
+		c.Logf("test %d: %q", i, t.args)
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(&renamedCommand{}, ctx, t.args)
+		c.Check(code, gc.Equals, t.code)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, t.output)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, t.err)
+	}
+}
+
+func (s *FlagDeprecationSuite) TestHelp(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(&renamedCommand{}, ctx, []string{"--help"})
+	c.Assert(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+Usage: renamed [options]
+
+Summary:
+print flags
+
+Options:
+-m, --model (= "")
+    model to use
+--timeout (= "")
+    time to wait
+--wait (= false)
+    wait for the result (deprecated)
+`[1:])
+}
+
+// superFlagDeprecations holds the deprecations of the SuperCommand
+// flags that the tests use.
+var superFlagDeprecations = map[string]cmd.FlagDeprecation{
+	"logging-config": {Status: cmd.FlagDeprecated, Replacement: "--log-level"},
+	"quiet":          {Status: cmd.FlagHidden},
+}
+
+func (s *FlagDeprecationSuite) TestSuperCommand(c *gc.C) {
+	for i, t := range []struct {
+		args   []string
+		code   int
+		output string
+		err    string
+	}{{
+		args:   []string{"--logging-config", "<root>=INFO", "renamed", "--wait"},
+		output: " true false\n",
+		err:    "WARNING: \"--logging-config\" is deprecated, please use \"--log-level\"\nWARNING: \"--wait\" is deprecated\n",
+	}, {
+		args:   []string{"renamed", "--logging-config", "<root>=INFO"},
+		output: " false false\n",
+		err:    "WARNING: \"--logging-config\" is deprecated, please use \"--log-level\"\n",
+	}, {
+		args: []string{"renamed", "--upload"},
+		code: 2,
+		err:  "error: \"--upload\" is obsolete, please use \"--build-agent\"\n",
+	}, {
+		args: []string{"renamed", "--legacy", "x"},
+		code: 2,
+		err:  "error: \"--legacy\" is obsolete\n",
+	}} {
+		c.Logf("test %d: %q", i, t.args)
+		loggo.ResetWriters()
+		super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:             "jujutest",
+			Log:              &cmd.Log{},
+			FlagDeprecations: superFlagDeprecations,
+		})
+		super.Register(&renamedCommand{})
+		ctx := cmdtesting.Context(c)
+		code := cmd.Main(super, ctx, t.args)
+		c.Check(code, gc.Equals, t.code)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, t.output)
+		c.Check(cmdtesting.Stderr(ctx), gc.Equals, t.err)
+	}
+}
+
+func (s *FlagDeprecationSuite) TestGlobalOptions(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:             "jujutest",
+		Log:              &cmd.Log{},
+		FlagDeprecations: superFlagDeprecations,
+	})
+	ctx, err := cmdtesting.RunCommand(c, super, "help", "global-options")
+	c.Assert(err, jc.ErrorIsNil)
+	help := cmdtesting.Stdout(ctx)
+	c.Check(help, jc.Contains, "--logging-config (= \"\")\n    specify log levels for modules (deprecated, use --log-level)\n")
+	c.Check(help, jc.Contains, "-q (= false)\n")
+	c.Check(help, gc.Not(jc.Contains), "--quiet")
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"launchpad.net/gnuflag"
+)
+
+// flagEnvExempt holds the names of flags that are never bound to
+// environment variables by a SuperCommand's FlagEnvPrefix.
+var flagEnvExempt = map[string]bool{
+	"help":        true,
+	"description": true,
+	"version":     true,
+}
+
+// flagEnvBindings returns the environment variables bound to the flags
+// in f, keyed by flag name. Flags named in explicit are bound to the
+// variable given there, or not at all if it is empty. If prefix is not
+// empty, every other flag with a long name is bound to the prefix
+// followed by its name in upper case, with hyphens replaced by
+// underscores.
+func flagEnvBindings(f *gnuflag.FlagSet, explicit map[string]string, prefix string) map[string]string {
+	bindings := make(map[string]string)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		name := flag.Name
+		if env, ok := explicit[name]; ok {
+			if env != "" {
+				bindings[name] = env
+			}
+			return
+		}
+		if prefix == "" || len(name) == 1 || flagEnvExempt[name] {
+			return
+		}
+		bindings[name] = prefix + strings.ToUpper(strings.Replace(name, "-", "_", -1))
+	})
+	return bindings
+}
+
+// givenFlags returns the values of the flags that were given on the
+// command line when the flag sets were parsed.
+func givenFlags(flagSets ...*gnuflag.FlagSet) map[gnuflag.Value]bool {
+	given := make(map[gnuflag.Value]bool)
+	for _, f := range flagSets {
+		if f == nil {
+			continue
+		}
+		f.Visit(func(flag *gnuflag.Flag) {
+			given[flag.Value] = true
+		})
+	}
+	return given
+}
+
+// setFlagsFromEnv sets each flag in f that has a binding, and was not
+// given on the command line, from its environment variable, if that is
+// set to a non-empty value. Values on the command line therefore take
+// precedence over the environment, which takes precedence over the
+// flags' defaults.
+func setFlagsFromEnv(ctx *Context, f *gnuflag.FlagSet, bindings map[string]string, given map[gnuflag.Value]bool) error {
+	names := make([]string, 0, len(bindings))
+	for name := range bindings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		flag := f.Lookup(name)
+		if flag == nil || given[flag.Value] {
+			continue
+		}
+		env := bindings[name]
+		value := ctx.Getenv(env)
+		if value == "" {
+			continue
+		}
+		if err := flag.Value.Set(value); err != nil {
+			return fmt.Errorf("invalid value %q for flag --%s from $%s: %v", value, name, env, err)
+		}
+		// Other names for the same flag are not set again.
+		given[flag.Value] = true
+	}
+	return nil
+}
+
+// setFlagsFromEnvironment sets the flags in f that are bound to
+// environment variables by c's Info, after f has been parsed by Main. A
+// SuperCommand sets its flags, and those of its subcommand, in Init.
+func setFlagsFromEnvironment(c Command, ctx *Context, f *gnuflag.FlagSet) error {
+	if _, ok := c.(*SuperCommand); ok {
+		return nil
+	}
+	bindings := flagEnvBindings(f, c.Info().FlagEnv, "")
+	return setFlagsFromEnv(ctx, f, bindings, givenFlags(f))
+}
+
+// printFlagDefaults writes the documentation for the flags in f to w,
+// noting the environment variable bound to each flag.
+func printFlagDefaults(w io.Writer, f *gnuflag.FlagSet, bindings map[string]string) {
+	envs := make(map[gnuflag.Value]string)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if env, ok := bindings[flag.Name]; ok {
+			envs[flag.Value] = env
+		}
+	})
+	usages := make(map[*gnuflag.Flag]string)
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		env, ok := envs[flag.Value]
+		if !ok {
+			return
+		}
+		usages[flag] = flag.Usage
+		note := "(env: $" + env + ")"
+		if flag.Usage == "" {
+			flag.Usage = note
+		} else {
+			flag.Usage += " " + note
+		}
+	})
+	f.SetOutput(w)
+	f.PrintDefaults()
+	for flag, usage := range usages {
+		flag.Usage = usage
+	}
+	if len(envs) > 0 {
+		fmt.Fprintf(w, "\nOptions given on the command line take precedence over environment variables.\n")
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"fmt"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+	"launchpad.net/gnuflag"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type FlagEnvSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&FlagEnvSuite{})
+
+// envCommand binds its flags to environment variables.
+type envCommand struct {
+	cmd.CommandBase
+	flagEnv map[string]string
+	option  string
+	count   int
+}
+
+func (c *envCommand) Info() *cmd.Info {
+	return &cmd.Info{
+		Name:    "env",
+		Purpose: "print flags",
+		FlagEnv: c.flagEnv,
+	}
+}
+
+func (c *envCommand) SetFlags(f *gnuflag.FlagSet) {
+	f.StringVar(&c.option, "option", "default", "option-doc")
+	f.IntVar(&c.count, "n", 1, "count-doc")
+	f.IntVar(&c.count, "count", 1, "")
+}
+
+func (c *envCommand) Run(ctx *cmd.Context) error {
+	fmt.Fprintf(ctx.Stdout, "%s %d\n", c.option, c.count)
+	return nil
+}
+
+func (s *FlagEnvSuite) TestCommandBindings(c *gc.C) {
+	flagEnv := map[string]string{"option": "TEST_OPTION", "count": "TEST_COUNT"}
+	for i, t := range []struct {
+		env    map[string]string
+		args   []string
+		code   int
+		output string
+		err    string
+	}{{
+		output: "default 1\n",
+	}, {
+		env:    map[string]string{"TEST_OPTION": "env", "TEST_COUNT": "3"},
+		output: "env 3\n",
+	}, {
+		env:    map[string]string{"TEST_OPTION": "env", "TEST_COUNT": "3"},
+		args:   []string{"--option", "arg", "-n", "4"},
+		output: "arg 4\n",
+	}, {
+		env:    map[string]string{"TEST_OPTION": ""},
+		output: "default 1\n",
+	}, {
+		env:  map[string]string{"TEST_COUNT": "many"},
+		code: 2,
+		err:  `error: invalid value "many" for flag --count from \$TEST_COUNT: .*\n`,
+	}} {
+		c.Logf("test %d: %v %q", i, t.env, t.args)
+		code, stdout, stderr := runMain(cmdtesting.Context(c), &envCommand{flagEnv: flagEnv}, t.env, t.args...)
+		c.Check(code, gc.Equals, t.code)
+		c.Check(stdout, gc.Equals, t.output)
+		if t.err == "" {
+			c.Check(stderr, gc.Equals, "")
+		} else {
+			c.Check(stderr, gc.Matches, t.err)
+		}
+	}
+}
+
+// prefixParams holds the parameters of the SuperCommands that the
+// prefix tests run, and prefixFlagEnv the bindings of their env
+// command's flags.
+var (
+	prefixParams = cmd.SuperCommandParams{
+		Name:          "jujutest",
+		FlagEnvPrefix: "JUJU_",
+		TimeoutFlag:   true,
+	}
+	prefixFlagEnv = map[string]string{"count": "", "option": "OPTION"}
+)
+
+func (s *FlagEnvSuite) TestPrefix(c *gc.C) {
+	env := map[string]string{
+		"JUJU_OPTION":  "prefixed",
+		"JUJU_COUNT":   "5",
+		"OPTION":       "explicit",
+		"JUJU_TIMEOUT": "forever",
+	}
+	for i, t := range []struct {
+		args   []string
+		code   int
+		output string
+		err    string
+	}{{
+		args: []string{"blah"},
+		code: 2,
+		err:  `error: invalid value "forever" for flag --timeout from \$JUJU_TIMEOUT: .*\n`,
+	}, {
+		args:   []string{"--timeout", "1m", "blah"},
+		output: "prefixed\n",
+	}, {
+		args:   []string{"blah", "--timeout", "1m", "--option", "arg"},
+		output: "arg\n",
+	}, {
+		args:   []string{"env", "--timeout=1m"},
+		output: "explicit 1\n",
+	}, {
+		args:   []string{"--timeout=1m", "sub", "blah"},
+		output: "prefixed\n",
+	}} {
+		c.Logf("test %d: %q", i, t.args)
+		code, stdout, stderr := runMain(cmdtesting.Context(c), newEnvSuper(prefixParams, prefixFlagEnv), env, t.args...)
+		c.Check(code, gc.Equals, t.code)
+		c.Check(stdout, gc.Equals, t.output)
+		if t.err == "" {
+			c.Check(stderr, gc.Equals, "")
+		} else {
+			c.Check(stderr, gc.Matches, t.err)
+		}
+	}
+}
+
+func (s *FlagEnvSuite) TestHelp(c *gc.C) {
+	code, stdout, _ := runMain(cmdtesting.Context(c), newEnvSuper(prefixParams, prefixFlagEnv), nil, "help", "env")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, gc.Equals, `Usage: jujutest env [options]
+
+Summary:
+print flags
+
+Options:
+-n, --count (= 1)
+    count-doc
+--option (= "default")
+    option-doc (env: $OPTION)
+
+Options given on the command line take precedence over environment variables.
+`)
+
+	code, stdout, _ = runMain(cmdtesting.Context(c), newEnvSuper(prefixParams, prefixFlagEnv), nil, "sub", "blah", "--help")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, jc.Contains, "--option (= \"\")\n    option-doc (env: $JUJU_OPTION)\n")
+
+	code, stdout, _ = runMain(cmdtesting.Context(c), newEnvSuper(prefixParams, prefixFlagEnv), nil, "help", "global-options")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, jc.Contains, "--timeout (= 0s)\n    stop the command if it runs for longer than this (e.g. 30s, 5m) (env: $JUJU_TIMEOUT)\n")
+	c.Check(stdout, gc.Not(jc.Contains), "JUJU_HELP")
+}
+
+func (s *FlagEnvSuite) TestHelpWithoutBindings(c *gc.C) {
+	code, stdout, _ := runMain(cmdtesting.Context(c), &TestCommand{Name: "verb"}, map[string]string{"JUJU_OPTION": "x"}, "--help")
+	c.Check(code, gc.Equals, 0)
+	c.Check(stdout, gc.Equals, fullHelp)
+}
@@ -19,15 +19,23 @@ type helpCommand struct {
 	topicArgs []string
 	topics    map[string]topic
 
+	// category, if set, restricts "help commands" to the subcommands
+	// in that category.
+	category string
+
 	target      *commandReference
 	targetSuper *SuperCommand
+
+	// missingSuper, if set, holds the nested SuperCommand whose
+	// MissingCallback is asked for help on the topic.
+	missingSuper *SuperCommand
 }
 
 func (c *helpCommand) init() {
 	c.topics = map[string]topic{
 		"commands": {
 			short: "Basic help for all commands",
-			long:  func() string { return c.super.describeCommands(true) },
+			long:  func() string { return c.super.describeCommands(true, true) },
 		},
 		"global-options": {
 			short: "Options common to all commands",
@@ -38,22 +46,28 @@ func (c *helpCommand) init() {
 			long:  func() string { return c.topicList() },
 		},
 	}
+	if c.super.pluginPrefix != "" {
+		c.topics[pluginsTopicName] = topic{
+			short:    "Show " + c.super.Name + " plugins",
+			describe: c.super.describePlugins,
+		}
+	}
 }
 
 func echo(s string) func() string {
 	return func() string { return s }
 }
 
-func (c *helpCommand) addTopic(name, short string, long func() string, aliases ...string) {
+func (c *helpCommand) addTopic(name, short string, long func() string, hidden bool, aliases ...string) {
 	if _, found := c.topics[name]; found {
 		panic(fmt.Sprintf("help topic already added: %s", name))
 	}
-	c.topics[name] = topic{short, long, false}
+	c.topics[name] = topic{short: short, long: long, hidden: hidden}
 	for _, alias := range aliases {
 		if _, found := c.topics[alias]; found {
 			panic(fmt.Sprintf("help topic already added: %s", alias))
 		}
-		c.topics[alias] = topic{short, long, true}
+		c.topics[alias] = topic{short: short, long: long, alias: true, hidden: hidden}
 	}
 }
 
@@ -68,8 +82,10 @@ command.
 
 	f := gnuflag.NewFlagSet("", gnuflag.ContinueOnError)
 	c.super.SetCommonFlags(f)
-	f.SetOutput(buf)
-	f.PrintDefaults()
+	if c.super.config != nil {
+		c.super.config.describe(f, c.super.configPath)
+	}
+	printFlagDefaults(buf, visibleFlags(f, c.super.flagDeprecations), flagEnvBindings(f, nil, c.super.flagEnvPrefix))
 	return buf.String()
 }
 
@@ -77,7 +93,7 @@ func (c *helpCommand) topicList() string {
 	var topics []string
 	longest := 0
 	for name, topic := range c.topics {
-		if topic.alias {
+		if topic.alias || !topic.listed() {
 			continue
 		}
 		if len(name) > longest {
@@ -118,6 +134,9 @@ func (c *helpCommand) Init(args []string) error {
 	// Before we start walking down the subcommand list, we want to check
 	// to see if the first part is there.
 	if _, ok := c.super.subcmds[args[0]]; !ok {
+		if args[0] == "commands" && len(args) == 2 {
+			return c.initCategory(args[1])
+		}
 		if c.super.missingCallback == nil && len(args) > 1 {
 			return fmt.Errorf("extra arguments to command help: %q", args[1:])
 		}
@@ -130,8 +149,14 @@ func (c *helpCommand) Init(args []string) error {
 	for len(args) > 0 {
 		c.topic, args = args[0], args[1:]
 		commandRef, ok := c.targetSuper.subcmds[c.topic]
+		if !ok && c.targetSuper.missingCallback != nil {
+			// The command may be provided by a plugin, which is
+			// given the remaining args.
+			c.target, c.missingSuper, c.topicArgs = nil, c.targetSuper, args
+			return nil
+		}
 		if !ok {
-			return fmt.Errorf("subcommand %q not found", c.topic)
+			return fmt.Errorf("subcommand %q not found%s", c.topic, didYouMean(suggest(c.topic, c.targetSuper.commandNames())))
 		}
 		c.target = &commandRef
 		// If there are more args and the target isn't a super command
@@ -146,8 +171,25 @@ func (c *helpCommand) Init(args []string) error {
 	return nil
 }
 
+// initCategory selects the category of commands listed by "help commands".
+func (c *helpCommand) initCategory(category string) error {
+	names := c.super.categoryNames()
+	for _, name := range names {
+		if name == category {
+			c.topic, c.category = "commands", category
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown command category %q%s", category, didYouMean(suggest(category, names)))
+}
+
 func (c *helpCommand) getCommandHelp(super *SuperCommand, command Command, alias string) []byte {
 	info := command.Info()
+	if sub, ok := command.(*SuperCommand); ok && sub.action.command == nil {
+		// Plugins are listed with the subcommands in help, but not
+		// in Info, which is used when no help is wanted.
+		info.Doc = sub.doc(true)
+	}
 
 	if command != super {
 		logger.Tracef("command not super")
@@ -165,6 +207,14 @@ func (c *helpCommand) getCommandHelp(super *SuperCommand, command Command, alias
 	}
 	f := gnuflag.NewFlagSet(info.Name, gnuflag.ContinueOnError)
 	command.SetFlags(f)
+	if super.config != nil {
+		path := super.configPath
+		if command != super {
+			path = append(path[:len(path):len(path)], command.Info().Name)
+		}
+		super.config.describe(f, path)
+	}
+	info.FlagEnv = flagEnvBindings(f, info.FlagEnv, super.flagEnvPrefix)
 	return info.Help(f)
 }
 
@@ -182,6 +232,14 @@ func (c *helpCommand) Run(ctx *Context) error {
 		return nil
 	}
 
+	if c.missingSuper != nil {
+		found, err := c.runMissingHelp(ctx, c.missingSuper)
+		if !found {
+			return fmt.Errorf("subcommand %q not found%s", c.topic, didYouMean(suggest(c.topic, c.missingSuper.commandNames())))
+		}
+		return err
+	}
+
 	// If there is no help topic specified, print basic usage.
 	if c.topic == "" {
 		// At this point, "help" is selected as the SuperCommand's
@@ -192,29 +250,55 @@ func (c *helpCommand) Run(ctx *Context) error {
 		return nil
 	}
 
+	if c.category != "" {
+		fmt.Fprintf(ctx.Stdout, "%s\n", c.super.describeCategory(c.category))
+		return nil
+	}
+
 	// Look to see if the topic is a registered topic.
 	topic, ok := c.topics[c.topic]
 	if ok {
-		fmt.Fprintf(ctx.Stdout, "%s\n", strings.TrimSpace(topic.long()))
+		fmt.Fprintf(ctx.Stdout, "%s\n", strings.TrimSpace(topic.text(ctx)))
 		return nil
 	}
 	// If we have a missing callback, call that with --help
 	if c.super.missingCallback != nil {
-		helpArgs := []string{"--help"}
-		if len(c.topicArgs) > 0 {
-			helpArgs = append(helpArgs, c.topicArgs...)
-		}
-		command := &missingCommand{
-			callback:  c.super.missingCallback,
-			superName: c.super.Name,
-			name:      c.topic,
-			args:      helpArgs,
-		}
-		err := command.Run(ctx)
-		_, isUnrecognized := err.(*UnrecognizedCommand)
-		if !isUnrecognized {
+		if found, err := c.runMissingHelp(ctx, c.super); found {
 			return err
 		}
 	}
-	return fmt.Errorf("unknown command or topic for %s", c.topic)
+	candidates := c.super.commandNames()
+	for name, topic := range c.topics {
+		if topic.listed() {
+			candidates = append(candidates, name)
+		}
+	}
+	return fmt.Errorf("unknown command or topic for %s%s", c.topic, didYouMean(suggest(c.topic, candidates)))
+}
+
+// runMissingHelp calls the MissingCallback of super with --help and the
+// topic's args, and reports whether the callback recognized the topic.
+// Plugins that describe their args or doc in JSON are not run; their
+// help is built from that description instead.
+func (c *helpCommand) runMissingHelp(ctx *Context, super *SuperCommand) (bool, error) {
+	if len(c.topicArgs) == 0 {
+		if help, ok := super.pluginHelp(c.topic); ok {
+			ctx.Stdout.Write(help)
+			return true, nil
+		}
+	}
+	helpArgs := []string{"--help"}
+	if len(c.topicArgs) > 0 {
+		helpArgs = append(helpArgs, c.topicArgs...)
+	}
+	command := &missingCommand{
+		callback:    super.missingCallback,
+		superName:   super.Name,
+		commandPath: super.prefixedName(super.Name),
+		name:        c.topic,
+		args:        helpArgs,
+	}
+	err := command.Run(ctx)
+	_, isUnrecognized := err.(*UnrecognizedCommand)
+	return !isUnrecognized, err
 }
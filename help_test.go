@@ -159,3 +159,101 @@ func (s *HelpCommandSuite) TestRegisterSuperAliasHelp(c *gc.C) {
 		c.Check(cmdtesting.Stdout(ctx), gc.Equals, help)
 	}
 }
+
+func (s *HelpCommandSuite) TestHidden(c *gc.C) {
+	newSuper := func() *cmd.SuperCommand {
+		super := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+		super.Register(&TestCommand{Name: "blah"})
+		super.RegisterHidden(&TestCommand{Name: "debug-state", Aliases: []string{"dump"}})
+		super.AddHelpTopic("storage", "storage help", "Storage.")
+		super.AddHiddenHelpTopic("internals", "how it works", "Internals.")
+		return super
+	}
+
+	ctx, err := cmdtesting.RunCommand(c, newSuper(), "help", "commands")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "blah  blah the juju\nhelp  show help on a command or other topic\n")
+	ctx, err = cmdtesting.RunCommand(c, newSuper(), "help", "topics")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Not(jc.Contains), "internals")
+
+	// Hidden commands and topics can still be used.
+	ctx, err = cmdtesting.RunCommand(c, newSuper(), "dump", "--option", "x")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "x\n")
+	ctx, err = cmdtesting.RunCommand(c, newSuper(), "help", "debug-state")
+	c.Assert(err, jc.ErrorIsNil)
+	s.assertStdOutMatches(c, ctx, "Usage: jujutest debug-state.*Aliases: dump")
+	ctx, err = cmdtesting.RunCommand(c, newSuper(), "help", "internals")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "Internals.\n")
+
+	s.PatchValue(&cmd.ShowHidden, true)
+	ctx, err = cmdtesting.RunCommand(c, newSuper(), "help", "commands")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+blah         blah the juju
+debug-state  debug-state the juju
+dump         alias for 'debug-state'
+help         show help on a command or other topic
+`[1:])
+	ctx, err = cmdtesting.RunCommand(c, newSuper(), "help", "topics")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), jc.Contains, "how it works")
+}
+
+func (s *HelpCommandSuite) TestCategories(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		Categories: []cmd.Category{
+			{Name: "model", Title: "Model management"},
+			{Name: "unused"},
+		},
+	})
+	super.Register(&TestCommand{Name: "deploy", Category: "application"})
+	super.Register(&TestCommand{Name: "add-model", Category: "model", Aliases: []string{"am"}})
+	super.Register(&TestCommand{Name: "destroy-model", Category: "model"})
+	super.Register(&TestCommand{Name: "status"})
+
+	c.Check(super.Info().Doc, gc.Equals, `
+Model management:
+    add-model     - add-model the juju
+    am            - alias for 'add-model'
+    destroy-model - destroy-model the juju
+
+application commands:
+    deploy        - deploy the juju
+
+other commands:
+    help          - show help on a command or other topic
+    status        - status the juju`[1:])
+
+	ctx, err := cmdtesting.RunCommand(c, super, "help", "commands")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+Model management:
+add-model      add-model the juju
+am             alias for 'add-model'
+destroy-model  destroy-model the juju
+
+application commands:
+deploy         deploy the juju
+
+other commands:
+help           show help on a command or other topic
+status         status the juju
+`[1:])
+
+	ctx, err = cmdtesting.RunCommand(c, super, "help", "commands", "model")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+add-model      add-model the juju
+am             alias for 'add-model'
+destroy-model  destroy-model the juju
+`[1:])
+
+	err = cmdtesting.InitCommand(super, []string{"help", "commands", "modle"})
+	c.Check(err, gc.ErrorMatches, `unknown command category "modle" \(did you mean "model"\?\)`)
+	err = cmdtesting.InitCommand(super, []string{"help", "commands", "unused"})
+	c.Check(err, gc.ErrorMatches, `unknown command category "unused"`)
+}
@@ -0,0 +1,505 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// jsonPath is a compiled JSONPath expression. It supports the root ($),
+// child (.name, ['name']), wildcard (.*, [*]), recursive descent
+// (..name), index ([0], [-1]), slice ([1:3]) and union ([0,2])
+// operators, along with filters comparing a relative path with a
+// literal ([?(@.status=='started')]).
+type jsonPath struct {
+	steps []jsonPathStep
+}
+
+// jsonPathStep selects values from each of the values produced by the
+// previous step.
+type jsonPathStep struct {
+	// recursive is true if the selector applies to all descendants.
+	recursive bool
+	selector  func(value interface{}) []interface{}
+}
+
+// parseJSONPath compiles expr. The expression may be surrounded by
+// braces, as in "{.items[*].name}", and the leading "$" is optional.
+func parseJSONPath(expr string) (*jsonPath, error) {
+	text := strings.TrimSpace(expr)
+	if strings.HasPrefix(text, "{") && strings.HasSuffix(text, "}") {
+		text = text[1 : len(text)-1]
+	}
+	p := &jsonPathParser{text: text}
+	path, err := p.parse(false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSONPath %q: %v", expr, err)
+	}
+	return path, nil
+}
+
+// eval returns the values selected by p from value, which must be in the
+// form produced by decoding JSON.
+func (p *jsonPath) eval(value interface{}) []interface{} {
+	values := []interface{}{value}
+	for _, step := range p.steps {
+		var next []interface{}
+		for _, v := range values {
+			if step.recursive {
+				for _, d := range jsonDescendants(v) {
+					next = append(next, step.selector(d)...)
+				}
+			} else {
+				next = append(next, step.selector(v)...)
+			}
+		}
+		values = next
+	}
+	return values
+}
+
+// jsonPathParser holds the state of parseJSONPath.
+type jsonPathParser struct {
+	text string
+	pos  int
+}
+
+func (p *jsonPathParser) peek(s string) bool {
+	return strings.HasPrefix(p.text[p.pos:], s)
+}
+
+func (p *jsonPathParser) skipSpace() {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// parse parses a path. If relative is true, the path starts at "@" and
+// ends at the first character that cannot continue it.
+func (p *jsonPathParser) parse(relative bool) (*jsonPath, error) {
+	path := &jsonPath{}
+	switch {
+	case relative && p.peek("@"):
+		p.pos++
+	case relative:
+		return nil, fmt.Errorf("expected @ at offset %d", p.pos)
+	case p.peek("$"):
+		p.pos++
+	case p.pos < len(p.text) && isNameChar(p.text[p.pos]):
+		// A leading name is a child of the root.
+		path.steps = append(path.steps, jsonPathStep{selector: childSelector(p.name())})
+	}
+	for p.pos < len(p.text) {
+		var step jsonPathStep
+		switch {
+		case p.peek(".."):
+			p.pos += 2
+			step.recursive = true
+			if p.peek("[") {
+				break
+			}
+			fallthrough
+		case p.peek("."):
+			if !step.recursive {
+				p.pos++
+			}
+			if p.peek("*") {
+				p.pos++
+				step.selector = wildcardSelector
+			} else if name := p.name(); name != "" {
+				step.selector = childSelector(name)
+			} else {
+				return nil, fmt.Errorf("expected name at offset %d", p.pos)
+			}
+		case p.peek("["):
+		default:
+			if relative {
+				return path, nil
+			}
+			return nil, fmt.Errorf("unexpected %q at offset %d", p.text[p.pos:p.pos+1], p.pos)
+		}
+		if step.selector == nil {
+			selector, err := p.subscript()
+			if err != nil {
+				return nil, err
+			}
+			step.selector = selector
+		}
+		path.steps = append(path.steps, step)
+	}
+	return path, nil
+}
+
+func isNameChar(c byte) bool {
+	return c == '_' || c == '-' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// name parses a field name.
+func (p *jsonPathParser) name() string {
+	start := p.pos
+	for p.pos < len(p.text) && isNameChar(p.text[p.pos]) {
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+// subscript parses a bracketed selector.
+func (p *jsonPathParser) subscript() (func(interface{}) []interface{}, error) {
+	p.pos++ // [
+	p.skipSpace()
+	var selector func(interface{}) []interface{}
+	switch {
+	case p.peek("*"):
+		p.pos++
+		selector = wildcardSelector
+	case p.peek("?("):
+		p.pos += 2
+		filter, err := p.filter()
+		if err != nil {
+			return nil, err
+		}
+		if !p.peek(")") {
+			return nil, fmt.Errorf("expected ) at offset %d", p.pos)
+		}
+		p.pos++
+		selector = filter
+	default:
+		var selectors []func(interface{}) []interface{}
+		for {
+			p.skipSpace()
+			s, err := p.member()
+			if err != nil {
+				return nil, err
+			}
+			selectors = append(selectors, s)
+			p.skipSpace()
+			if !p.peek(",") {
+				break
+			}
+			p.pos++
+		}
+		selector = func(value interface{}) []interface{} {
+			var result []interface{}
+			for _, s := range selectors {
+				result = append(result, s(value)...)
+			}
+			return result
+		}
+	}
+	p.skipSpace()
+	if !p.peek("]") {
+		return nil, fmt.Errorf("expected ] at offset %d", p.pos)
+	}
+	p.pos++
+	return selector, nil
+}
+
+// member parses a quoted name, an index or a slice within brackets.
+func (p *jsonPathParser) member() (func(interface{}) []interface{}, error) {
+	if p.peek("'") || p.peek(`"`) {
+		name, err := p.quoted()
+		if err != nil {
+			return nil, err
+		}
+		return childSelector(name), nil
+	}
+	start, hasStart, err := p.integer()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peek(":") {
+		if !hasStart {
+			return nil, fmt.Errorf("expected index at offset %d", p.pos)
+		}
+		return indexSelector(start), nil
+	}
+	p.pos++
+	end, hasEnd, err := p.integer()
+	if err != nil {
+		return nil, err
+	}
+	return sliceSelector(start, hasStart, end, hasEnd), nil
+}
+
+// integer parses an optional integer.
+func (p *jsonPathParser) integer() (int, bool, error) {
+	start := p.pos
+	if p.peek("-") {
+		p.pos++
+	}
+	for p.pos < len(p.text) && p.text[p.pos] >= '0' && p.text[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, false, nil
+	}
+	n, err := strconv.Atoi(p.text[start:p.pos])
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid index %q", p.text[start:p.pos])
+	}
+	return n, true, nil
+}
+
+// quoted parses a string literal in single or double quotes.
+func (p *jsonPathParser) quoted() (string, error) {
+	quote := p.text[p.pos]
+	end := strings.IndexByte(p.text[p.pos+1:], quote)
+	if end < 0 {
+		return "", fmt.Errorf("unterminated string at offset %d", p.pos)
+	}
+	s := p.text[p.pos+1 : p.pos+1+end]
+	p.pos += end + 2
+	return s, nil
+}
+
+// filter parses the condition of a filter selector.
+func (p *jsonPathParser) filter() (func(interface{}) []interface{}, error) {
+	p.skipSpace()
+	path, err := p.parse(true)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	op := ""
+	for _, candidate := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.peek(candidate) {
+			op = candidate
+			p.pos += len(candidate)
+			break
+		}
+	}
+	var literal interface{}
+	if op != "" {
+		p.skipSpace()
+		if literal, err = p.literal(); err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+	}
+	match := func(value interface{}) bool {
+		found := path.eval(value)
+		if op == "" {
+			return len(found) > 0
+		}
+		for _, f := range found {
+			if compareJSON(f, op, literal) {
+				return true
+			}
+		}
+		return false
+	}
+	return func(value interface{}) []interface{} {
+		var result []interface{}
+		for _, v := range jsonChildren(value) {
+			if match(v) {
+				result = append(result, v)
+			}
+		}
+		return result
+	}, nil
+}
+
+// literal parses a string, number, boolean or null.
+func (p *jsonPathParser) literal() (interface{}, error) {
+	if p.peek("'") || p.peek(`"`) {
+		return p.quoted()
+	}
+	start := p.pos
+	for p.pos < len(p.text) && !strings.ContainsRune(" )", rune(p.text[p.pos])) {
+		p.pos++
+	}
+	text := p.text[start:p.pos]
+	switch text {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	}
+	if _, err := strconv.ParseFloat(text, 64); err != nil {
+		return nil, fmt.Errorf("invalid literal %q", text)
+	}
+	return json.Number(text), nil
+}
+
+// compareJSON reports whether "value op literal" holds.
+func compareJSON(value interface{}, op string, literal interface{}) bool {
+	if n, ok := value.(json.Number); ok {
+		if l, ok := literal.(json.Number); ok {
+			a, errA := n.Float64()
+			b, errB := l.Float64()
+			if errA != nil || errB != nil {
+				return false
+			}
+			switch op {
+			case "==":
+				return a == b
+			case "!=":
+				return a != b
+			case "<":
+				return a < b
+			case "<=":
+				return a <= b
+			case ">":
+				return a > b
+			case ">=":
+				return a >= b
+			}
+		}
+	}
+	if s, ok := value.(string); ok {
+		if l, ok := literal.(string); ok {
+			switch op {
+			case "==":
+				return s == l
+			case "!=":
+				return s != l
+			case "<":
+				return s < l
+			case "<=":
+				return s <= l
+			case ">":
+				return s > l
+			case ">=":
+				return s >= l
+			}
+		}
+	}
+	switch op {
+	case "==":
+		return value == literal
+	case "!=":
+		return value != literal
+	}
+	return false
+}
+
+func childSelector(name string) func(interface{}) []interface{} {
+	return func(value interface{}) []interface{} {
+		if m, ok := value.(map[string]interface{}); ok {
+			if v, ok := m[name]; ok {
+				return []interface{}{v}
+			}
+		}
+		return nil
+	}
+}
+
+func wildcardSelector(value interface{}) []interface{} {
+	return jsonChildren(value)
+}
+
+func indexSelector(i int) func(interface{}) []interface{} {
+	return func(value interface{}) []interface{} {
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		index := i
+		if index < 0 {
+			index += len(list)
+		}
+		if index < 0 || index >= len(list) {
+			return nil
+		}
+		return []interface{}{list[index]}
+	}
+}
+
+func sliceSelector(start int, hasStart bool, end int, hasEnd bool) func(interface{}) []interface{} {
+	return func(value interface{}) []interface{} {
+		list, ok := value.([]interface{})
+		if !ok {
+			return nil
+		}
+		from, to := 0, len(list)
+		if hasStart {
+			from = start
+		}
+		if hasEnd {
+			to = end
+		}
+		if from < 0 {
+			from += len(list)
+		}
+		if to < 0 {
+			to += len(list)
+		}
+		if from < 0 {
+			from = 0
+		}
+		if to > len(list) {
+			to = len(list)
+		}
+		if from >= to {
+			return nil
+		}
+		return list[from:to]
+	}
+}
+
+// jsonChildren returns the elements of a list or the values of a map,
+// ordered by key.
+func jsonChildren(value interface{}) []interface{} {
+	switch value := value.(type) {
+	case []interface{}:
+		return value
+	case map[string]interface{}:
+		keys := make([]string, 0, len(value))
+		for key := range value {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		result := make([]interface{}, len(keys))
+		for i, key := range keys {
+			result[i] = value[key]
+		}
+		return result
+	}
+	return nil
+}
+
+// jsonDescendants returns value and everything nested within it.
+func jsonDescendants(value interface{}) []interface{} {
+	result := []interface{}{value}
+	for _, child := range jsonChildren(value) {
+		result = append(result, jsonDescendants(child)...)
+	}
+	return result
+}
+
+// NewJSONPathFormatter returns a Formatter that writes the results of
+// evaluating the given JSONPath expression against the value as it is
+// represented in JSON, one per line. Strings are written as they are;
+// other results are written as JSON.
+func NewJSONPathFormatter(expr string) (Formatter, error) {
+	path, err := parseJSONPath(expr)
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}) ([]byte, error) {
+		data, err := jsonValue(value)
+		if err != nil {
+			return nil, err
+		}
+		var lines []string
+		for _, result := range path.eval(data) {
+			if s, ok := result.(string); ok {
+				lines = append(lines, s)
+				continue
+			}
+			line, err := json.Marshal(result)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, string(line))
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	}, nil
+}
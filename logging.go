@@ -57,6 +57,7 @@ func (log *Log) Start(ctx *Context) error {
 	}
 	ctx.quiet = log.Quiet
 	ctx.verbose = log.Verbose
+	ctx.log = log
 	if log.Path != "" {
 		path := ctx.AbsPath(log.Path)
 		target, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
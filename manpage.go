@@ -0,0 +1,256 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+const manPagesCommandName = "__manpages"
+
+// ManPage holds a rendered man(7) page.
+type ManPage struct {
+	// Name is the name of the page, e.g. "juju-bootstrap".
+	Name string
+
+	// Section is the manual section of the page.
+	Section int
+
+	// Content holds the page in roff format.
+	Content []byte
+}
+
+// Filename returns the conventional file name for the page,
+// e.g. "juju-bootstrap.1".
+func (p ManPage) Filename() string {
+	return fmt.Sprintf("%s.%d", p.Name, p.Section)
+}
+
+// ManPages returns a man page for c and one for each of the commands
+// registered beneath it, recursing into nested SuperCommands. The page
+// for c also describes the help topics added with AddHelpTopic.
+func (c *SuperCommand) ManPages() []ManPage {
+	var pages []ManPage
+	root := c.commandTree(false)
+	root.walk(func(node *commandNode) {
+		pages = append(pages, ManPage{
+			Name:    manPageName(node),
+			Section: 1,
+			Content: c.manPage(root, node),
+		})
+	})
+	return pages
+}
+
+// WriteManPages writes the pages returned by ManPages into dir.
+func (c *SuperCommand) WriteManPages(dir string) error {
+	for _, page := range c.ManPages() {
+		if err := ioutil.WriteFile(filepath.Join(dir, page.Filename()), page.Content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// manPageName returns the name of the man page for node.
+func manPageName(node *commandNode) string {
+	return strings.Join(node.path, "-")
+}
+
+// manPage renders the man page for node, which is part of the tree
+// under root.
+func (c *SuperCommand) manPage(root, node *commandNode) []byte {
+	buf := &bytes.Buffer{}
+	name := manPageName(node)
+	source := root.info.Name
+	if c.version != "" {
+		source += " " + c.version
+	}
+	fmt.Fprintf(buf, ".TH %s 1 \"\" %s %s\n",
+		roffQuote(strings.ToUpper(name)), roffQuote(source), roffQuote(root.info.Name+" manual"))
+
+	fmt.Fprintf(buf, ".SH NAME\n")
+	if purpose := firstLine(node.info.Purpose); purpose != "" {
+		fmt.Fprintf(buf, "%s \\- %s\n", roffEscape(name), roffEscape(purpose))
+	} else {
+		fmt.Fprintf(buf, "%s\n", roffEscape(name))
+	}
+
+	fmt.Fprintf(buf, ".SH SYNOPSIS\n")
+	fmt.Fprintf(buf, ".B %s\n", roffEscape(node.name()))
+	var synopsis []string
+	if len(node.flags) > 0 {
+		synopsis = append(synopsis, "[options]")
+	}
+	if node.info.Args != "" {
+		synopsis = append(synopsis, node.info.Args)
+	}
+	if len(synopsis) > 0 {
+		fmt.Fprintf(buf, "%s\n", roffEscape(strings.Join(synopsis, " ")))
+	}
+
+	if purpose, doc := strings.TrimSpace(node.info.Purpose), strings.TrimSpace(node.info.Doc); purpose != "" || doc != "" {
+		fmt.Fprintf(buf, ".SH DESCRIPTION\n")
+		writeRoffText(buf, purpose)
+		if purpose != "" && doc != "" {
+			fmt.Fprintf(buf, ".PP\n")
+		}
+		writeRoffText(buf, doc)
+	}
+
+	if len(node.flags) > 0 {
+		fmt.Fprintf(buf, ".SH OPTIONS\n")
+		for _, flag := range node.flags {
+			fmt.Fprintf(buf, ".TP\n")
+			fmt.Fprintf(buf, ".B %s\n", roffEscape(strings.Join(flag.names, ", ")))
+			usage := flag.usage
+			if !flag.isBool && flag.defValue != "" {
+				usage = strings.TrimSpace(usage + " (default: " + flag.defValue + ")")
+			}
+			writeRoffText(buf, usage)
+		}
+	}
+
+	if len(node.subcmds) > 0 {
+		fmt.Fprintf(buf, ".SH COMMANDS\n")
+		for _, child := range node.subcmds {
+			fmt.Fprintf(buf, ".TP\n")
+			fmt.Fprintf(buf, ".B %s\n", roffEscape(child.path[len(child.path)-1]))
+			writeRoffText(buf, firstLine(child.info.Purpose))
+		}
+	}
+
+	if len(node.aliases) > 0 {
+		fmt.Fprintf(buf, ".SH ALIASES\n")
+		var names []string
+		for _, alias := range node.aliases {
+			names = append(names, alias.name)
+		}
+		fmt.Fprintf(buf, "%s\n", roffEscape(strings.Join(names, ", ")))
+	}
+
+	if node == root && len(root.topics) > 0 {
+		fmt.Fprintf(buf, ".SH HELP TOPICS\n")
+		for _, topic := range root.topics {
+			fmt.Fprintf(buf, ".SS %s\n", roffQuote(topic.name))
+			writeRoffText(buf, topic.short)
+			if topic.long != "" {
+				fmt.Fprintf(buf, ".PP\n")
+				writeRoffText(buf, topic.long)
+			}
+		}
+	}
+
+	var seeAlso []string
+	if len(node.path) > 1 {
+		seeAlso = append(seeAlso, strings.Join(node.path[:len(node.path)-1], "-"))
+	}
+	for _, child := range node.subcmds {
+		seeAlso = append(seeAlso, manPageName(child))
+	}
+	if len(seeAlso) > 0 {
+		fmt.Fprintf(buf, ".SH SEE ALSO\n")
+		for i, page := range seeAlso {
+			sep := ","
+			if i == len(seeAlso)-1 {
+				sep = ""
+			}
+			fmt.Fprintf(buf, ".BR %s (1)%s\n", roffEscape(page), sep)
+		}
+	}
+	return buf.Bytes()
+}
+
+// writeRoffText writes text as roff paragraphs. Blank lines separate
+// paragraphs, and indented lines are written without filling so that
+// lists and examples keep their layout.
+func writeRoffText(buf *bytes.Buffer, text string) {
+	if text == "" {
+		return
+	}
+	noFill := false
+	for _, line := range strings.Split(text, "\n") {
+		indented := strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")
+		if indented != noFill && strings.TrimSpace(line) != "" {
+			if indented {
+				fmt.Fprintf(buf, ".nf\n")
+			} else {
+				fmt.Fprintf(buf, ".fi\n")
+			}
+			noFill = indented
+		}
+		switch {
+		case strings.TrimSpace(line) == "" && noFill:
+			fmt.Fprintf(buf, "\n")
+		case strings.TrimSpace(line) == "":
+			fmt.Fprintf(buf, ".PP\n")
+		default:
+			fmt.Fprintf(buf, "%s\n", roffLine(line))
+		}
+	}
+	if noFill {
+		fmt.Fprintf(buf, ".fi\n")
+	}
+}
+
+// roffEscape escapes the characters in s that are special to roff.
+func roffEscape(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	return strings.Replace(s, "-", `\-`, -1)
+}
+
+// roffLine escapes a line of text, taking care that it is not read as
+// a request.
+func roffLine(s string) string {
+	s = strings.Replace(s, `\`, `\e`, -1)
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
+
+// roffQuote quotes s as a request argument.
+func roffQuote(s string) string {
+	return `"` + strings.Replace(roffEscape(s), `"`, `\(dq`, -1) + `"`
+}
+
+// manPagesCommand implements the hidden "__manpages" subcommand, which
+// writes the man pages for the command tree into a directory.
+type manPagesCommand struct {
+	CommandBase
+	super *SuperCommand
+	dir   string
+}
+
+func (c *manPagesCommand) Info() *Info {
+	return &Info{
+		Name:    manPagesCommandName,
+		Args:    "[<directory>]",
+		Purpose: "write man pages for all commands",
+	}
+}
+
+func (c *manPagesCommand) Init(args []string) error {
+	dir, err := ZeroOrOneArgs(args)
+	if err != nil {
+		return err
+	}
+	c.dir = dir
+	return nil
+}
+
+func (c *manPagesCommand) Run(ctx *Context) error {
+	dir := ctx.AbsPath(c.dir)
+	if err := c.super.WriteManPages(dir); err != nil {
+		return err
+	}
+	for _, page := range c.super.ManPages() {
+		fmt.Fprintln(ctx.Stdout, filepath.Join(dir, page.Filename()))
+	}
+	return nil
+}
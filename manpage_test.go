@@ -0,0 +1,174 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type ManPageSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&ManPageSuite{})
+
+// manPageParams holds the parameters of the SuperCommands that the man
+// page tests describe.
+var manPageParams = cmd.SuperCommandParams{
+	Name:     "jujutest",
+	Purpose:  "test man pages",
+	Doc:      "Jujutest does things.\n\nExamples:\n    jujutest defenestrate\n.dotted line",
+	Version:  "1.2.3",
+	ManPages: true,
+}
+
+func (s *ManPageSuite) pages(c *gc.C) map[string]string {
+	pages := make(map[string]string)
+	for _, page := range newTestSuper(manPageParams).ManPages() {
+		c.Check(page.Section, gc.Equals, 1)
+		pages[page.Filename()] = string(page.Content)
+	}
+	return pages
+}
+
+func (s *ManPageSuite) TestPageNames(c *gc.C) {
+	var names []string
+	for _, page := range newTestSuper(manPageParams).ManPages() {
+		names = append(names, page.Name)
+	}
+	c.Assert(names, jc.DeepEquals, []string{
+		"jujutest",
+		"jujutest-bar",
+		"jujutest-bar-foo",
+		"jujutest-bar-help",
+		"jujutest-defenestrate",
+		"jujutest-help",
+		"jujutest-version",
+	})
+}
+
+func (s *ManPageSuite) TestRootPage(c *gc.C) {
+	page := s.pages(c)["jujutest.1"]
+	c.Check(page, jc.HasPrefix, `.TH "JUJUTEST" 1 "" "jujutest 1.2.3" "jujutest manual"
+.SH NAME
+jujutest \- test man pages
+.SH SYNOPSIS
+.B jujutest
+[options] <command> ...
+.SH DESCRIPTION
+test man pages
+.PP
+Jujutest does things.
+.PP
+Examples:
+.nf
+    jujutest defenestrate
+.fi
+\&.dotted line
+.SH OPTIONS
+.TP
+.B \-\-description
+.TP
+.B \-h, \-\-help
+show help on a command or other topic
+.TP
+.B \-\-version
+show the command's version and exit
+.SH COMMANDS
+.TP
+.B bar
+bar functions
+.TP
+.B defenestrate
+defenestrate the juju
+.TP
+.B help
+show help on a command or other topic
+.TP
+.B version
+print the current version
+`)
+	c.Check(page, jc.Contains, `
+.SH HELP TOPICS
+.SS "concepts"
+Basic concepts
+.PP
+Try jujutest defenestrate.
+.PP
+See also:
+.nf
+    defenestrate
+    topics
+.fi
+.SH SEE ALSO
+.BR jujutest\-bar (1),
+.BR jujutest\-defenestrate (1),
+.BR jujutest\-help (1),
+.BR jujutest\-version (1)
+`)
+	// Aliases and deprecated commands do not have pages.
+	c.Check(page, gc.Not(jc.Contains), "throw")
+	c.Check(page, gc.Not(jc.Contains), "bar-foo")
+}
+
+func (s *ManPageSuite) TestCommandPage(c *gc.C) {
+	page := s.pages(c)["jujutest-defenestrate.1"]
+	c.Check(page, gc.Equals, `.TH "JUJUTEST\-DEFENESTRATE" 1 "" "jujutest 1.2.3" "jujutest manual"
+.SH NAME
+jujutest\-defenestrate \- defenestrate the juju
+.SH SYNOPSIS
+.B jujutest defenestrate
+[options] <something>
+.SH DESCRIPTION
+defenestrate the juju
+.PP
+defenestrate-doc
+.SH OPTIONS
+.TP
+.B \-\-description
+.TP
+.B \-h, \-\-help
+show help on a command or other topic
+.TP
+.B \-\-option
+option-doc
+.SH ALIASES
+jujutest defen, jujutest throw
+.SH SEE ALSO
+.BR jujutest (1)
+`)
+	page = s.pages(c)["jujutest-bar-foo.1"]
+	c.Check(page, jc.Contains, ".SH ALIASES\njujutest bar\\-foo\n")
+	c.Check(page, jc.Contains, ".SH SEE ALSO\n.BR jujutest\\-bar (1)\n")
+}
+
+func (s *ManPageSuite) TestHiddenCommand(c *gc.C) {
+	dir := c.MkDir()
+	err := os.Mkdir(filepath.Join(dir, "man"), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+	sc := newTestSuper(manPageParams)
+	c.Check(sc.Info().Doc, gc.Not(jc.Contains), "__manpages")
+	ctx, err := cmdtesting.RunCommandInDir(c, sc, []string{"__manpages", "man"}, dir)
+	c.Assert(err, jc.ErrorIsNil)
+	written := strings.Split(strings.TrimSpace(cmdtesting.Stdout(ctx)), "\n")
+	c.Assert(written, gc.HasLen, 7)
+	c.Check(written[0], gc.Equals, filepath.Join(dir, "man", "jujutest.1"))
+	content, err := ioutil.ReadFile(filepath.Join(dir, "man", "jujutest-bar-foo.1"))
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(string(content), jc.HasPrefix, `.TH "JUJUTEST\-BAR\-FOO" 1`)
+
+	plain := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	_, err = cmdtesting.RunCommand(c, plain, "__manpages")
+	c.Assert(err, gc.ErrorMatches, "unrecognized command: jujutest __manpages")
+}
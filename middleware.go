@@ -0,0 +1,47 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+// RunInfo describes a subcommand that a SuperCommand is about to run.
+type RunInfo struct {
+	// Path holds the full name of the subcommand, including the names
+	// of the SuperCommands that selected it; for example
+	// "juju model add".
+	Path string
+
+	// Command holds the subcommand. The commands that a MissingCallback
+	// runs, such as plugins, only give their name in Info.
+	Command Command
+
+	// Args holds the positional args that the subcommand was
+	// initialized with, after flags were parsed and user aliases were
+	// expanded.
+	Args []string
+}
+
+// Middleware wraps the Run of the subcommands that a SuperCommand
+// selects; see SuperCommandParams.Middleware. It is given the Context
+// and details of the subcommand, and calls next to run the remaining
+// middleware and the subcommand itself, returning the resulting error or
+// one of its own. Middleware that does not call next stops the
+// subcommand from running.
+type Middleware func(ctx *Context, run RunInfo, next func(ctx *Context) error) error
+
+// middlewareChain returns the middleware that c's subcommands run
+// within, including that inherited from the SuperCommands above c.
+func (c *SuperCommand) middlewareChain() []Middleware {
+	chain := c.parentMiddleware[:len(c.parentMiddleware):len(c.parentMiddleware)]
+	return append(chain, c.middleware...)
+}
+
+// runMiddleware runs the subcommand described by run within the given
+// middleware, the first of which is the outermost.
+func runMiddleware(ctx *Context, middleware []Middleware, run RunInfo) error {
+	if len(middleware) == 0 {
+		return run.Command.Run(ctx)
+	}
+	return middleware[0](ctx, run, func(ctx *Context) error {
+		return runMiddleware(ctx, middleware[1:], run)
+	})
+}
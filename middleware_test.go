@@ -0,0 +1,113 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"errors"
+	"fmt"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type MiddlewareSuite struct {
+	gitjujutesting.IsolationSuite
+	calls []string
+}
+
+var _ = gc.Suite(&MiddlewareSuite{})
+
+func (s *MiddlewareSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.calls = nil
+}
+
+// record returns Middleware that records the commands it runs, and the
+// errors they return, under the given name.
+func (s *MiddlewareSuite) record(name string) cmd.Middleware {
+	return func(ctx *cmd.Context, run cmd.RunInfo, next func(ctx *cmd.Context) error) error {
+		s.calls = append(s.calls, fmt.Sprintf("%s: run %s %q", name, run.Path, run.Args))
+		err := next(ctx)
+		s.calls = append(s.calls, fmt.Sprintf("%s: %v", name, err))
+		return err
+	}
+}
+
+func (s *MiddlewareSuite) TestMiddleware(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:       "jujutest",
+		Middleware: []cmd.Middleware{s.record("outer"), s.record("inner")},
+	})
+	model := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:        "model",
+		UsagePrefix: "jujutest",
+		Middleware:  []cmd.Middleware{s.record("model")},
+	})
+	model.Register(&failingCommand{runErr: errors.New("boom")})
+	super.Register(model)
+	super.Register(&TestCommand{Name: "bar"})
+
+	_, err := cmdtesting.RunCommand(c, super, "model", "fail", "a", "b")
+	checkRunError(c, err, "boom")
+	c.Check(s.calls, jc.DeepEquals, []string{
+		`outer: run jujutest model fail ["a" "b"]`,
+		`inner: run jujutest model fail ["a" "b"]`,
+		`model: run jujutest model fail ["a" "b"]`,
+		`model: boom`,
+		`inner: boom`,
+		`outer: boom`,
+	})
+
+	s.calls = nil
+	_, err = cmdtesting.RunCommand(c, super, "bar")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(s.calls, jc.DeepEquals, []string{
+		`outer: run jujutest bar []`,
+		`inner: run jujutest bar []`,
+		`inner: <nil>`,
+		`outer: <nil>`,
+	})
+}
+
+func (s *MiddlewareSuite) TestMiddlewareStopsRun(c *gc.C) {
+	deny := func(ctx *cmd.Context, run cmd.RunInfo, next func(ctx *cmd.Context) error) error {
+		return fmt.Errorf("%s: permission denied", run.Path)
+	}
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:       "jujutest",
+		Middleware: []cmd.Middleware{deny, s.record("inner")},
+	})
+	super.Register(&TestCommand{Name: "bar"})
+
+	ctx, err := cmdtesting.RunCommand(c, super, "bar")
+	checkRunError(c, err, "jujutest bar: permission denied")
+	c.Check(s.calls, gc.HasLen, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "")
+}
+
+func (s *MiddlewareSuite) TestMiddlewareHelp(c *gc.C) {
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:       "jujutest",
+		Version:    "1.0.0",
+		Middleware: []cmd.Middleware{s.record("outer")},
+	})
+	super.Register(&TestCommand{Name: "bar"})
+
+	for _, args := range [][]string{{"help"}, {"bar", "--help"}, {"version"}} {
+		_, err := cmdtesting.RunCommand(c, super, args...)
+		c.Assert(err, jc.ErrorIsNil)
+	}
+	c.Check(s.calls, jc.DeepEquals, []string{
+		`outer: run jujutest help []`,
+		`outer: <nil>`,
+		`outer: run jujutest help ["bar"]`,
+		`outer: <nil>`,
+		`outer: run jujutest version []`,
+		`outer: <nil>`,
+	})
+}
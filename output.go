@@ -4,14 +4,15 @@
 package cmd
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
 	"io"
-	"os"
 	"reflect"
 	"sort"
 	"strconv"
 	"strings"
+	"text/template"
 
 	goyaml "gopkg.in/yaml.v2"
 	"launchpad.net/gnuflag"
@@ -85,15 +86,79 @@ func FormatSmart(value interface{}) ([]byte, error) {
 // DefaultFormatters holds the formatters that can be
 // specified with the --format flag.
 var DefaultFormatters = map[string]Formatter{
-	"smart": FormatSmart,
-	"yaml":  FormatYaml,
-	"json":  FormatJson,
+	"smart":   FormatSmart,
+	"yaml":    FormatYaml,
+	"json":    FormatJson,
+	"tabular": FormatTabular,
+}
+
+// ParameterisedFormatter creates Formatters that are configured by a
+// parameter, given on the command line as --format name=parameter.
+type ParameterisedFormatter struct {
+	// Placeholder describes the parameter in the documentation for
+	// the --format flag, e.g. "<template>".
+	Placeholder string
+
+	// New returns a Formatter configured by param, or an error if
+	// param is not valid.
+	New func(param string) (Formatter, error)
+}
+
+// DefaultParameterisedFormatters holds the parameterised formatters that
+// can be specified with the --format flag.
+var DefaultParameterisedFormatters = map[string]ParameterisedFormatter{
+	"template": {"<template>", NewTemplateFormatter},
+	"jsonpath": {"<expression>", NewJSONPathFormatter},
+}
+
+// NewTemplateFormatter returns a Formatter that executes the given
+// text/template against the value as it is represented in JSON, so
+// fields have the names that FormatJson gives them, e.g.
+// '{{range .}}{{.name}}{{"\n"}}{{end}}'.
+func NewTemplateFormatter(text string) (Formatter, error) {
+	t, err := template.New("format").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(value interface{}) ([]byte, error) {
+		data, err := jsonValue(value)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err := t.Execute(&buf, data); err != nil {
+			return nil, err
+		}
+		return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+	}, nil
+}
+
+// jsonValue returns value as it is represented in JSON: as maps, slices,
+// strings, bools and json.Numbers.
+func jsonValue(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var result interface{}
+	if err := decoder.Decode(&result); err != nil {
+		return nil, err
+	}
+	return result, nil
 }
 
 // formatterValue implements gnuflag.Value for the --format flag.
 type formatterValue struct {
-	name       string
-	formatters map[string]Formatter
+	name          string
+	param         string
+	formatter     Formatter
+	formatters    map[string]Formatter
+	parameterised map[string]ParameterisedFormatter
+	// check, if set, checks the chosen format against the other
+	// flags once they have all been parsed.
+	check func() error
 }
 
 // newFormatterValue returns a new formatterValue. The initial Formatter name
@@ -106,71 +171,166 @@ func newFormatterValue(initial string, formatters map[string]Formatter) *formatt
 	return v
 }
 
-// Set stores the chosen formatter name in v.name.
+// Set stores the chosen formatter name in v.name. A value of the form
+// name=param chooses a parameterised formatter, which is configured
+// immediately so that an invalid parameter is reported as a bad flag.
 func (v *formatterValue) Set(value string) error {
-	if v.formatters[value] == nil {
-		return fmt.Errorf("unknown format %q", value)
+	if formatter := v.formatters[value]; formatter != nil {
+		v.name, v.param, v.formatter = value, "", formatter
+		return nil
 	}
-	v.name = value
-	return nil
+	if i := strings.Index(value, "="); i > 0 {
+		if p, ok := v.parameterised[value[:i]]; ok {
+			formatter, err := p.New(value[i+1:])
+			if err != nil {
+				return err
+			}
+			v.name, v.param, v.formatter = value[:i], value[i+1:], formatter
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown format %q", value)
 }
 
-// String returns the chosen formatter name.
+// String returns the chosen formatter name, along with its parameter if
+// it has one.
 func (v *formatterValue) String() string {
+	if v.param != "" {
+		return v.name + "=" + v.param
+	}
 	return v.name
 }
 
 // doc returns documentation for the --format flag.
 func (v *formatterValue) doc() string {
-	choices := make([]string, len(v.formatters))
-	i := 0
+	choices := make([]string, 0, len(v.formatters))
 	for name := range v.formatters {
-		choices[i] = name
-		i++
+		choices = append(choices, name)
 	}
 	sort.Strings(choices)
+	var parameterised []string
+	for name, p := range v.parameterised {
+		parameterised = append(parameterised, name+"="+p.Placeholder)
+	}
+	sort.Strings(parameterised)
+	choices = append(choices, parameterised...)
 	return "Specify output format (" + strings.Join(choices, "|") + ")"
 }
 
+// checkParsed implements parsedFlagChecker.
+func (v *formatterValue) checkParsed() error {
+	if v.check == nil {
+		return nil
+	}
+	return v.check()
+}
+
+// parsedFlagChecker is implemented by flag values that can only be
+// checked once all the flags have been parsed, because they depend on
+// the values of other flags.
+type parsedFlagChecker interface {
+	checkParsed() error
+}
+
+// checkParsedFlags checks the values of the flags in the flag sets that
+// implement parsedFlagChecker.
+func checkParsedFlags(flagSets ...*gnuflag.FlagSet) error {
+	var err error
+	for _, f := range flagSets {
+		f.VisitAll(func(flag *gnuflag.Flag) {
+			if checker, ok := flag.Value.(parsedFlagChecker); ok && err == nil {
+				err = checker.checkParsed()
+			}
+		})
+	}
+	return err
+}
+
 // format runs the chosen formatter on value.
 func (v *formatterValue) format(value interface{}) ([]byte, error) {
-	return v.formatters[v.name](value)
+	return v.formatter(value)
 }
 
+// OutputFlag identifies an optional flag that Output.AddFlags can add.
+type OutputFlag int
+
+const (
+	// ColumnsFlag adds the --columns flag, which selects and orders
+	// the columns written by the "tabular" format.
+	ColumnsFlag OutputFlag = iota + 1
+
+	// NoHeadersFlag adds the --no-headers flag, which omits the header
+	// row written by the "tabular" format.
+	NoHeadersFlag
+
+	// AppendFlag adds the --append flag, which appends to the --output
+	// file instead of replacing it.
+	AppendFlag
+
+	// NoClobberFlag adds the --no-clobber flag, which prevents an
+	// existing --output file from being replaced.
+	NoClobberFlag
+
+	// FileModeFlag adds the --file-mode flag, which sets the
+	// permissions of the --output file.
+	FileModeFlag
+)
+
 // Output is responsible for interpreting output-related command line flags
 // and writing a value to a file or to stdout as directed.
 type Output struct {
 	formatter *formatterValue
 	outPath   string
+	columns   string
+	noHeaders bool
+	append    bool
+	noClobber bool
+	fileMode  fileModeValue
 }
 
-// AddFlags injects the --format and --output command line flags into f.
-func (c *Output) AddFlags(f *gnuflag.FlagSet, defaultFormatter string, formatters map[string]Formatter) {
+// AddFlags injects the --format and --output command line flags into f,
+// along with any of the optional flags requested. As well as the given
+// formatters, --format accepts those in DefaultParameterisedFormatters.
+func (c *Output) AddFlags(f *gnuflag.FlagSet, defaultFormatter string, formatters map[string]Formatter, optional ...OutputFlag) {
 	c.formatter = newFormatterValue(defaultFormatter, formatters)
+	c.formatter.parameterised = DefaultParameterisedFormatters
+	c.formatter.check = c.checkFlags
 	f.Var(c.formatter, "format", c.formatter.doc())
 	f.StringVar(&c.outPath, "o", "", "Specify an output file")
 	f.StringVar(&c.outPath, "output", "", "")
+	for _, flag := range optional {
+		switch flag {
+		case ColumnsFlag:
+			f.StringVar(&c.columns, "columns", "", "Comma-separated list of columns to show, in order (tabular format only)")
+		case NoHeadersFlag:
+			f.BoolVar(&c.noHeaders, "no-headers", false, "Do not show column headers (tabular format only)")
+		case AppendFlag:
+			f.BoolVar(&c.append, "append", false, "Append to the output file instead of replacing it")
+		case NoClobberFlag:
+			f.BoolVar(&c.noClobber, "no-clobber", false, "Do not replace an existing output file")
+		case FileModeFlag:
+			f.Var(&c.fileMode, "file-mode", "Specify the permissions of the output file, in octal (default 0644, or those of the file being replaced)")
+		}
+	}
 }
 
 // Write formats and outputs the value as directed by the --format and
-// --output command line flags.
+// --output command line flags. The --output file is only replaced once
+// the value has been written successfully.
 func (c *Output) Write(ctx *Context, value interface{}) (err error) {
-	var target io.Writer
-	if c.outPath == "" {
-		target = ctx.Stdout
-	} else {
-		path := ctx.AbsPath(c.outPath)
-		var f *os.File
-		if f, err = os.Create(path); err != nil {
-			return
-		}
-		defer f.Close()
-		target = f
+	bytes, err := c.format(value)
+	if err != nil {
+		return
 	}
-	bytes, err := c.formatter.format(value)
+	target, closeTarget, err := c.openTarget(ctx)
 	if err != nil {
 		return
 	}
+	defer func() {
+		if closeErr := closeTarget(err == nil); err == nil {
+			err = closeErr
+		}
+	}()
 	if len(bytes) > 0 {
 		_, err = target.Write(bytes)
 		if err == nil {
@@ -180,6 +340,55 @@ func (c *Output) Write(ctx *Context, value interface{}) (err error) {
 	return
 }
 
+// openTarget returns the writer chosen by the --output flag, along with
+// a function that closes it. The function's argument reports whether
+// everything was written successfully; if not, the --output file is
+// left as it was, unless it is being appended to.
+func (c *Output) openTarget(ctx *Context) (io.Writer, func(commit bool) error, error) {
+	if c.outPath == "" {
+		return ctx.Stdout, func(bool) error { return nil }, nil
+	}
+	f, err := c.openFile(ctx.AbsPath(c.outPath))
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.close, nil
+}
+
+// format runs the chosen formatter on value. The --columns and
+// --no-headers flags replace the formatter named "tabular" with
+// FormatTabular, configured accordingly.
+func (c *Output) format(value interface{}) ([]byte, error) {
+	if c.columns == "" && !c.noHeaders {
+		return c.formatter.format(value)
+	}
+	if err := c.checkFlags(); err != nil {
+		return nil, err
+	}
+	return formatTabular(value, c.columnNames(), !c.noHeaders)
+}
+
+// checkFlags returns an error if --columns or --no-headers was given
+// along with a format other than "tabular". Main and SuperCommand check
+// this once the flags have been parsed.
+func (c *Output) checkFlags() error {
+	if (c.columns != "" || c.noHeaders) && c.formatter.name != "tabular" {
+		return fmt.Errorf("--columns and --no-headers require --format tabular")
+	}
+	return nil
+}
+
+// columnNames returns the columns chosen with the --columns flag.
+func (c *Output) columnNames() []string {
+	var columns []string
+	for _, column := range strings.Split(c.columns, ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
 func (c *Output) Name() string {
 	return c.formatter.name
 }
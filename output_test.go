@@ -4,6 +4,10 @@
 package cmd_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
 	gc "gopkg.in/check.v1"
 	"launchpad.net/gnuflag"
 
@@ -111,6 +115,35 @@ var outputTests = map[string][]struct {
 		{[]string{"blam", "dink"}, "- blam\n- dink\n"},
 		{defaultValue, "juju: 1\npuppet: false\n"},
 	},
+	"tabular": {
+		{nil, ""},
+		{1, "1\n"},
+		{"hello", "hello\n"},
+		{[]string{"blam", "dink"}, "blam\ndink\n"},
+		{defaultValue, "Juju  Puppet\n1     false\n"},
+		{[]machine{}, "ID  STATUS  Addresses\n"},
+		{machines, "ID  STATUS   Addresses\n0   started  10.0.0.1,10.0.0.2\n10  pending\n"},
+		{[]*machine{&machines[1], nil}, "ID  STATUS   Addresses\n10  pending\n"},
+		{[]map[string]interface{}{
+			{"name": "mysql", "units": 2},
+			{"name": "wordpress\tblog", "exposed": true},
+		}, "exposed  name            units\n         mysql           2\ntrue     wordpress blog\n"},
+		{map[string]string{"b": "2", "a": "1"}, "a  b\n1  2\n"},
+	},
+}
+
+// machine is used to test the tabular format.
+type machine struct {
+	Id        string `yaml:"id" tabular:"ID"`
+	Status    string `json:"STATUS"`
+	Addresses []string
+	hidden    string
+	Omitted   int `tabular:"-"`
+}
+
+var machines = []machine{
+	{Id: "0", Status: "started", Addresses: []string{"10.0.0.1", "10.0.0.2"}},
+	{Id: "10", Status: "pending"},
 }
 
 func (s *CmdSuite) TestOutputFormat(c *gc.C) {
@@ -149,3 +182,366 @@ func (s *CmdSuite) TestFormatAlternativeSyntax(c *gc.C) {
 	c.Assert(result, gc.Equals, 0)
 	c.Assert(bufferString(ctx.Stdout), gc.Equals, "null\n")
 }
+
+// TabularCommand is a command that uses the optional tabular flags.
+type TabularCommand struct {
+	OutputCommand
+}
+
+func (c *TabularCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.out.AddFlags(f, "tabular", cmd.DefaultFormatters, cmd.ColumnsFlag, cmd.NoHeadersFlag)
+}
+
+func (s *CmdSuite) TestTabularColumns(c *gc.C) {
+	for i, t := range []struct {
+		args   []string
+		output string
+		code   int
+		err    string
+	}{{
+		args:   []string{"--columns", "status,id"},
+		output: "STATUS   ID\nstarted  0\npending  10\n",
+	}, {
+		args:   []string{"--columns", "addresses", "--no-headers"},
+		output: "10.0.0.1,10.0.0.2\n\n",
+	}, {
+		args:   []string{"--no-headers"},
+		output: "0   started  10.0.0.1,10.0.0.2\n10  pending\n",
+	}, {
+		args: []string{"--columns", "id,machine"},
+		code: 1,
+		err:  `error: unknown column "machine" \(valid columns: ID, STATUS, Addresses\)\n`,
+	}, {
+		args: []string{"--format", "yaml", "--columns", "id"},
+		code: 2,
+		err:  "error: --columns and --no-headers require --format tabular\n",
+	}, {
+		args: []string{"--no-headers", "--format", "json"},
+		code: 2,
+		err:  "error: --columns and --no-headers require --format tabular\n",
+	}, {
+		args:   []string{"--columns", "id", "--format", "tabular"},
+		output: "ID\n0\n10\n",
+	}} {
+		c.Logf("test %d: %q", i, t.args)
+		ctx := cmdtesting.Context(c)
+		result := cmd.Main(&TabularCommand{OutputCommand{value: machines}}, ctx, t.args)
+		c.Check(result, gc.Equals, t.code)
+		c.Check(bufferString(ctx.Stdout), gc.Equals, t.output)
+		if t.err == "" {
+			c.Check(bufferString(ctx.Stderr), gc.Equals, "")
+		} else {
+			c.Check(bufferString(ctx.Stderr), gc.Matches, t.err)
+		}
+	}
+}
+
+func (s *CmdSuite) TestParameterisedFormats(c *gc.C) {
+	value := map[string]interface{}{
+		"model":    "default",
+		"machines": machines,
+		"count":    10000000,
+		"lists": []interface{}{
+			[]string{"x", "y", "z"},
+			[]string{"p", "q", "r", "s", "t"},
+			[]string{"a"},
+		},
+	}
+	for i, t := range []struct {
+		format string
+		output string
+	}{{
+		format: "template={{.model}}: {{len .machines}} machines",
+		output: "default: 2 machines\n",
+	}, {
+		format: `template={{range .machines}}{{.Id}} {{.STATUS}}{{"\n"}}{{end}}`,
+		output: "0 started\n10 pending\n",
+	}, {
+		format: "template={{.count}}",
+		output: "10000000\n",
+	}, {
+		format: "jsonpath=$.model",
+		output: "default\n",
+	}, {
+		format: "jsonpath={.machines[*].Id}",
+		output: "0\n10\n",
+	}, {
+		format: "jsonpath=machines[-1].STATUS",
+		output: "pending\n",
+	}, {
+		format: "jsonpath=$.machines[0].Addresses",
+		output: `["10.0.0.1","10.0.0.2"]` + "\n",
+	}, {
+		format: "jsonpath=$..Addresses[1]",
+		output: "10.0.0.2\n",
+	}, {
+		format: "jsonpath=$.machines[?(@.STATUS == 'pending')].Id",
+		output: "10\n",
+	}, {
+		format: "jsonpath=$.machines[?(@.Addresses != null)]['Id','STATUS']",
+		output: "0\nstarted\n",
+	}, {
+		format: "jsonpath=$.count",
+		output: "10000000\n",
+	}, {
+		format: "jsonpath=$.missing",
+		output: "",
+	}, {
+		format: "jsonpath=$.lists[*][-1]",
+		output: "z\nt\na\n",
+	}, {
+		format: "jsonpath=$.lists[*][-2]",
+		output: "y\ns\n",
+	}, {
+		format: "jsonpath=$.lists[*][-2:]",
+		output: "y\nz\ns\nt\na\n",
+	}} {
+		c.Logf("test %d: %s", i, t.format)
+		ctx := cmdtesting.Context(c)
+		result := cmd.Main(&OutputCommand{value: value}, ctx, []string{"--format", t.format})
+		c.Check(result, gc.Equals, 0)
+		c.Check(bufferString(ctx.Stdout), gc.Equals, t.output)
+		c.Check(bufferString(ctx.Stderr), gc.Equals, "")
+	}
+}
+
+func (s *CmdSuite) TestInvalidParameterisedFormat(c *gc.C) {
+	for i, t := range []struct {
+		format string
+		err    string
+	}{{
+		format: "template={{.model",
+		err:    `.*invalid value "template={{.model" for flag --format: template: format:1: .*`,
+	}, {
+		format: "jsonpath=$.machines[",
+		err:    `.*invalid value .* for flag --format: invalid JSONPath "\$.machines\[": expected index at offset 11`,
+	}, {
+		format: "cuneiform=x",
+		err:    `.*unknown format "cuneiform=x"`,
+	}} {
+		c.Logf("test %d: %s", i, t.format)
+		ctx := cmdtesting.Context(c)
+		result := cmd.Main(&OutputCommand{}, ctx, []string{"--format", t.format})
+		c.Check(result, gc.Equals, 2)
+		c.Check(bufferString(ctx.Stdout), gc.Equals, "")
+		c.Check(bufferString(ctx.Stderr), gc.Matches, t.err+"\n")
+	}
+}
+
+func (s *CmdSuite) TestParameterisedFormatsDoc(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&OutputCommand{}, ctx, []string{"--help"})
+	c.Check(result, gc.Equals, 0)
+	c.Check(bufferString(ctx.Stdout), gc.Matches, `(?s).*--format \(= smart\)\n    Specify output format \(json\|smart\|tabular\|yaml\|jsonpath=<expression>\|template=<template>\)\n.*`)
+}
+
+// StreamCommand is a command that writes its values to an OutputStream.
+type StreamCommand struct {
+	OutputCommand
+	values []interface{}
+}
+
+func (c *StreamCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.out.AddFlags(f, "tabular", cmd.DefaultFormatters, cmd.ColumnsFlag, cmd.NoHeadersFlag)
+}
+
+func (c *StreamCommand) Run(ctx *cmd.Context) (err error) {
+	stream, err := c.out.Stream(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := stream.Close(); err == nil {
+			err = closeErr
+		}
+	}()
+	for _, value := range c.values {
+		if err := stream.Write(value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *CmdSuite) TestOutputStream(c *gc.C) {
+	values := []interface{}{
+		machines[0],
+		nil,
+		[]machine{{Id: "100", Status: "down"}, {Id: "1000", Status: "provisioning error"}},
+	}
+	for i, t := range []struct {
+		args   []string
+		output string
+	}{{
+		args:   []string{"--format", "json"},
+		output: `{"Id":"0","STATUS":"started","Addresses":["10.0.0.1","10.0.0.2"],"Omitted":0}` + "\nnull\n" + `[{"Id":"100","STATUS":"down","Addresses":null,"Omitted":0},{"Id":"1000","STATUS":"provisioning error","Addresses":null,"Omitted":0}]` + "\n",
+	}, {
+		args:   []string{"--format", "yaml", "--output", "out.yaml"},
+		output: "id: \"0\"\nstatus: started\naddresses:\n- 10.0.0.1\n- 10.0.0.2\nomitted: 0\n---\n- id: \"100\"\n  status: down\n  addresses: []\n  omitted: 0\n- id: \"1000\"\n  status: provisioning error\n  addresses: []\n  omitted: 0\n",
+	}, {
+		args: []string{},
+		output: "" +
+			"ID  STATUS   Addresses\n" +
+			"0   started  10.0.0.1,10.0.0.2\n" +
+			"1…  down\n" +
+			"1…  provis…\n",
+	}, {
+		args:   []string{"--columns", "status,id", "--no-headers", "--output", "out.txt"},
+		output: "started  0\ndown     100\nprovis…  1000\n",
+	}, {
+		args:   []string{"--format", "jsonpath=$..Id"},
+		output: "0\n100\n1000\n",
+	}} {
+		c.Logf("test %d: %q", i, t.args)
+		ctx := cmdtesting.Context(c)
+		result := cmd.Main(&StreamCommand{values: values}, ctx, t.args)
+		c.Check(result, gc.Equals, 0)
+		c.Check(bufferString(ctx.Stderr), gc.Equals, "")
+		output := bufferString(ctx.Stdout)
+		if n := len(t.args); n > 1 && t.args[n-2] == "--output" {
+			c.Check(output, gc.Equals, "")
+			content, err := ioutil.ReadFile(filepath.Join(ctx.Dir, t.args[n-1]))
+			c.Assert(err, gc.IsNil)
+			output = string(content)
+		}
+		c.Check(output, gc.Equals, t.output)
+	}
+}
+
+func (s *CmdSuite) TestOutputStreamWideCell(c *gc.C) {
+	// Columns keep the widths of the first record, so a wider cell is
+	// truncated to keep later rows aligned.
+	values := []interface{}{
+		machines[0],
+		[]machine{{Id: "100", Status: "provisioning error"}, {Id: "1", Status: "down"}},
+	}
+	ctx := cmdtesting.Context(c)
+	result := cmd.Main(&StreamCommand{values: values}, ctx, nil)
+	c.Check(result, gc.Equals, 0)
+	c.Check(bufferString(ctx.Stdout), gc.Equals, ""+
+		"ID  STATUS   Addresses\n"+
+		"0   started  10.0.0.1,10.0.0.2\n"+
+		"1…  provis…\n"+
+		"1   down\n")
+}
+
+// OutputFileCommand is a command that uses the optional --output file
+// flags.
+type OutputFileCommand struct {
+	OutputCommand
+}
+
+func (c *OutputFileCommand) SetFlags(f *gnuflag.FlagSet) {
+	c.out.AddFlags(f, "smart", cmd.DefaultFormatters, cmd.AppendFlag, cmd.NoClobberFlag, cmd.FileModeFlag)
+}
+
+func (s *CmdSuite) TestOutputFile(c *gc.C) {
+	for i, t := range []struct {
+		about    string
+		existing string
+		args     []string
+		code     int
+		content  string
+		mode     os.FileMode
+		err      string
+	}{{
+		about:   "new file",
+		args:    []string{},
+		content: "hello\n",
+		mode:    0644,
+	}, {
+		about:    "replace, keeping mode",
+		existing: "old\n",
+		args:     []string{},
+		content:  "hello\n",
+		mode:     0600,
+	}, {
+		about:    "replace with mode",
+		existing: "old\n",
+		args:     []string{"--file-mode", "0640"},
+		content:  "hello\n",
+		mode:     0640,
+	}, {
+		about:    "failure leaves file untouched",
+		existing: "old\n",
+		args:     []string{"--format", "template={{.a.b}}"},
+		code:     1,
+		content:  "old\n",
+		mode:     0600,
+		err:      "error: template: .*\n",
+	}, {
+		about:    "append",
+		existing: "old\n",
+		args:     []string{"--append"},
+		content:  "old\nhello\n",
+		mode:     0600,
+	}, {
+		about:   "append to new file",
+		args:    []string{"--append", "--file-mode", "600"},
+		content: "hello\n",
+		mode:    0600,
+	}, {
+		about:   "no clobber, new file",
+		args:    []string{"--no-clobber"},
+		content: "hello\n",
+		mode:    0644,
+	}, {
+		about:    "no clobber, existing file",
+		existing: "old\n",
+		args:     []string{"--no-clobber"},
+		code:     1,
+		content:  "old\n",
+		mode:     0600,
+		err:      `error: output file ".*out.txt" already exists\n`,
+	}, {
+		about: "append and no clobber",
+		args:  []string{"--append", "--no-clobber"},
+		code:  1,
+		err:   "error: --append and --no-clobber cannot be used together\n",
+	}, {
+		about: "invalid mode",
+		args:  []string{"--file-mode", "0800"},
+		code:  2,
+		err:   `error: invalid value "0800" for flag --file-mode: invalid file mode "0800"\n`,
+	}} {
+		c.Logf("test %d: %s", i, t.about)
+		ctx := cmdtesting.Context(c)
+		path := filepath.Join(ctx.Dir, "out.txt")
+		if t.existing != "" {
+			err := ioutil.WriteFile(path, []byte(t.existing), 0600)
+			c.Assert(err, gc.IsNil)
+		}
+		args := append([]string{"--output", "out.txt"}, t.args...)
+		result := cmd.Main(&OutputFileCommand{OutputCommand{value: "hello"}}, ctx, args)
+		c.Check(result, gc.Equals, t.code)
+		if t.err == "" {
+			c.Check(bufferString(ctx.Stderr), gc.Equals, "")
+		} else {
+			c.Check(bufferString(ctx.Stderr), gc.Matches, t.err)
+		}
+		if t.content != "" {
+			content, err := ioutil.ReadFile(path)
+			c.Assert(err, gc.IsNil)
+			c.Check(string(content), gc.Equals, t.content)
+			info, err := os.Stat(path)
+			c.Assert(err, gc.IsNil)
+			c.Check(info.Mode().Perm(), gc.Equals, t.mode)
+		}
+		// No temporary files are left behind.
+		infos, err := ioutil.ReadDir(ctx.Dir)
+		c.Assert(err, gc.IsNil)
+		for _, info := range infos {
+			c.Check(info.Name(), gc.Equals, "out.txt")
+		}
+	}
+}
+
+func (s *CmdSuite) TestTabularColumnsInSuperCommand(c *gc.C) {
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	sc.Register(&TabularCommand{OutputCommand{value: machines}})
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(sc, ctx, []string{"output", "--format", "yaml", "--no-headers"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(bufferString(ctx.Stdout), gc.Equals, "")
+	c.Check(bufferString(ctx.Stderr), gc.Equals, "error: --columns and --no-headers require --format tabular\n")
+}
@@ -0,0 +1,134 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// defaultOutputFileMode holds the permissions given to a new --output
+// file when --file-mode is not specified.
+const defaultOutputFileMode os.FileMode = 0644
+
+// outputFile writes the --output file. Unless it is appending, it writes
+// to a temporary file in the same directory, which replaces the output
+// file only when it is closed successfully, so that a failure never
+// leaves a partially written file behind.
+type outputFile struct {
+	*os.File
+	// path holds the output file's path when writing to a temporary
+	// file, and is empty when appending.
+	path      string
+	mode      os.FileMode
+	noClobber bool
+}
+
+// openFile opens the output file at path, as directed by the --append,
+// --no-clobber and --file-mode flags.
+func (c *Output) openFile(path string) (*outputFile, error) {
+	if c.append && c.noClobber {
+		return nil, fmt.Errorf("--append and --no-clobber cannot be used together")
+	}
+	mode := c.fileMode.mode
+	if c.append {
+		if mode == 0 {
+			mode = defaultOutputFileMode
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, mode)
+		if err != nil {
+			return nil, err
+		}
+		return &outputFile{File: file}, nil
+	}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && c.noClobber:
+		return nil, fmt.Errorf("output file %q already exists", path)
+	case err == nil:
+		// Replace the file a symlink refers to, not the symlink.
+		if path, err = filepath.EvalSymlinks(path); err != nil {
+			return nil, err
+		}
+		if mode == 0 {
+			mode = info.Mode().Perm()
+		}
+	case os.IsNotExist(err):
+		if mode == 0 {
+			mode = defaultOutputFileMode
+		}
+	default:
+		return nil, err
+	}
+	file, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return nil, err
+	}
+	return &outputFile{
+		File:      file,
+		path:      path,
+		mode:      mode,
+		noClobber: c.noClobber,
+	}, nil
+}
+
+// close finishes writing the file. If commit is false, any existing
+// output file is left untouched.
+func (f *outputFile) close(commit bool) error {
+	if f.path == "" {
+		return f.File.Close()
+	}
+	err := f.File.Chmod(f.mode)
+	if err == nil {
+		err = f.File.Sync()
+	}
+	if closeErr := f.File.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil || !commit {
+		os.Remove(f.Name())
+		return err
+	}
+	if f.noClobber {
+		// Unlike rename, link fails if a file has been created at
+		// path since it was opened.
+		err = os.Link(f.Name(), f.path)
+		os.Remove(f.Name())
+		if os.IsExist(err) {
+			return fmt.Errorf("output file %q already exists", f.path)
+		}
+		return err
+	}
+	if err := os.Rename(f.Name(), f.path); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// fileModeValue implements gnuflag.Value for the --file-mode flag.
+type fileModeValue struct {
+	mode os.FileMode
+}
+
+// Set parses value as octal permissions, e.g. "0600".
+func (v *fileModeValue) Set(value string) error {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode == 0 || mode > 0777 {
+		return fmt.Errorf("invalid file mode %q", value)
+	}
+	v.mode = os.FileMode(mode)
+	return nil
+}
+
+// String returns the permissions in octal, or "" if none were set.
+func (v *fileModeValue) String() string {
+	if v.mode == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%#o", uint32(v.mode))
+}
@@ -0,0 +1,288 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"launchpad.net/gnuflag"
+)
+
+// pluginsTopicName is the name of the help topic that lists plugins.
+const pluginsTopicName = "plugins"
+
+// Plugin describes an executable that provides a subcommand: a plugin
+// with the prefix "juju-" named "juju-foo" is run by "juju foo".
+type Plugin struct {
+	// Name holds the name of the subcommand that runs the plugin.
+	Name string
+
+	// Path holds the path of the executable.
+	Path string
+}
+
+// FindPlugins returns the plugins on the PATH held by ctx.Env whose names
+// start with prefix, in name order. Where more than one executable has
+// the same name, the first on the PATH is used.
+func FindPlugins(ctx *Context, prefix string) []Plugin {
+	found := make(map[string]bool)
+	var plugins []Plugin
+	for _, dir := range pluginDirs(ctx) {
+		infos, err := ioutil.ReadDir(dir)
+		if err != nil {
+			logger.Tracef("cannot read plugin directory %q: %v", dir, err)
+			continue
+		}
+		for _, info := range infos {
+			name := strings.TrimPrefix(info.Name(), prefix)
+			if name == info.Name() || name == "" || found[name] {
+				continue
+			}
+			path := filepath.Join(dir, info.Name())
+			if info.Mode()&os.ModeSymlink != 0 {
+				if info, err = os.Stat(path); err != nil {
+					continue
+				}
+			}
+			if !isExecutable(info) {
+				continue
+			}
+			found[name] = true
+			plugins = append(plugins, Plugin{Name: name, Path: path})
+		}
+	}
+	sort.Sort(pluginsByName(plugins))
+	return plugins
+}
+
+// LookPlugin returns the plugin with the given prefix that provides the
+// named subcommand, searching the PATH held by ctx.Env.
+func LookPlugin(ctx *Context, prefix, name string) (Plugin, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return Plugin{}, fmt.Errorf("invalid plugin name %q", name)
+	}
+	for _, dir := range pluginDirs(ctx) {
+		path := filepath.Join(dir, prefix+name)
+		if info, err := os.Stat(path); err == nil && isExecutable(info) {
+			return Plugin{Name: name, Path: path}, nil
+		}
+	}
+	return Plugin{}, fmt.Errorf("plugin %q not found", prefix+name)
+}
+
+// Run runs the plugin with the given arguments in ctx's directory and
+// environment, connected to ctx's Stdin, Stdout and Stderr. If the
+// plugin exits with a non-zero code, Run returns an RcPassthroughError
+// holding the code.
+func (p Plugin) Run(ctx *Context, args []string) error {
+	command := p.command(ctx, ctx, args)
+	command.Stdin = ctx.Stdin
+	command.Stdout = ctx.Stdout
+	command.Stderr = ctx.Stderr
+	return pluginError(command.Run())
+}
+
+// Description returns the output of running the plugin with the
+// --description flag, which plugins are required to support, or the
+// purpose it gives when run with --describe-json if it says that it
+// supports that flag. A plugin that fails, or takes longer than
+// DefaultPluginTimeout, is described as such. See also DescribePlugins.
+func (p Plugin) Description(ctx *Context) string {
+	info, err := p.probe(ctx, DefaultPluginTimeout)
+	if err != nil {
+		return p.failure(err)
+	}
+	return info.Purpose
+}
+
+// command returns the command that runs the plugin in ctx. The plugin
+// is killed if stdctx is done before it finishes.
+func (p Plugin) command(ctx *Context, stdctx context.Context, args []string) *exec.Cmd {
+	command := exec.CommandContext(stdctx, p.Path, args...)
+	command.Dir = ctx.Dir
+	if ctx.Env != nil {
+		command.Env = []string{}
+		for key, value := range ctx.Env {
+			command.Env = append(command.Env, key+"="+value)
+		}
+		sort.Strings(command.Env)
+	}
+	return command
+}
+
+// pluginError returns the error to report when a plugin run by Run
+// finishes with err.
+func pluginError(err error) error {
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return err
+	}
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok && status.ExitStatus() > 0 {
+		return NewRcPassthroughError(status.ExitStatus())
+	}
+	return err
+}
+
+// PluginMissingCallback returns a MissingCallback that runs the plugin
+// with the given prefix that provides the missing subcommand, if there
+// is one.
+func PluginMissingCallback(prefix string) MissingCallback {
+	return func(ctx *Context, subcommand string, args []string) error {
+		plugin, err := LookPlugin(ctx, prefix, subcommand)
+		if err != nil {
+			logger.Tracef("%v", err)
+			return &UnrecognizedCommand{Name: subcommand}
+		}
+		logger.Debugf("running plugin %q", plugin.Path)
+		return plugin.Run(ctx, args)
+	}
+}
+
+// findPlugins returns the plugins that provide subcommands of c, when c
+// has a plugin prefix and is run by Main. Plugins that have the name of
+// a subcommand or user alias are left out, since they cannot be run.
+func (c *SuperCommand) findPlugins() []Plugin {
+	if c.pluginPrefix == "" || c.initContext == nil {
+		return nil
+	}
+	if c.plugins == nil {
+		c.plugins = []Plugin{}
+		for _, plugin := range FindPlugins(c.initContext, c.pluginPrefix) {
+			_, isAlias := c.userAliases[plugin.Name]
+			if _, found := c.subcmds[plugin.Name]; found || isAlias && !c.noAlias {
+				continue
+			}
+			c.plugins = append(c.plugins, plugin)
+		}
+	}
+	return c.plugins
+}
+
+// describedPlugins returns the details of the plugins of c, keyed by
+// name, as described by the plugins themselves.
+func (c *SuperCommand) describedPlugins() map[string]pluginInfo {
+	if c.pluginPrefix == "" || c.initContext == nil {
+		return nil
+	}
+	if c.pluginDetails == nil {
+		plugins := c.findPlugins()
+		infos := pluginInfos(c.initContext, plugins, c.pluginCacheFile, c.pluginTimeout)
+		c.pluginDetails = make(map[string]pluginInfo)
+		for i, plugin := range plugins {
+			c.pluginDetails[plugin.Name] = infos[i]
+		}
+	}
+	return c.pluginDetails
+}
+
+// pluginEntries returns the entries that list the plugins of c with its
+// subcommands, keyed by name.
+func (c *SuperCommand) pluginEntries() map[string]commandEntry {
+	entries := make(map[string]commandEntry)
+	for name, info := range c.describedPlugins() {
+		entries[name] = commandEntry{
+			name:     name,
+			purpose:  info.Purpose + " (plugin)",
+			category: info.Category,
+		}
+	}
+	return entries
+}
+
+// pluginHelp returns the help for the named plugin of c, built from the
+// args and doc that it gave when run with --describe-json. It returns
+// false if the plugin gave neither, in which case the plugin should be
+// asked for help itself.
+func (c *SuperCommand) pluginHelp(name string) ([]byte, bool) {
+	info, found := c.pluginDetails[name]
+	if !found {
+		// Only the named plugin needs to describe itself.
+		for _, plugin := range c.findPlugins() {
+			if plugin.Name == name {
+				info, found = pluginInfos(c.initContext, []Plugin{plugin}, "", c.pluginTimeout)[0], true
+				break
+			}
+		}
+	}
+	if !found || info.Args == "" && info.Doc == "" {
+		return nil, false
+	}
+	f := gnuflag.NewFlagSet(name, gnuflag.ContinueOnError)
+	return (&Info{
+		Name:    c.prefixedName(c.Name + " " + name),
+		Args:    info.Args,
+		Purpose: info.Purpose,
+		Doc:     info.Doc,
+	}).Help(f), true
+}
+
+// describePlugins returns the text of the "help plugins" topic, which
+// describes the plugins that provide subcommands of c.
+func (c *SuperCommand) describePlugins(ctx *Context) string {
+	buf := &bytes.Buffer{}
+	fmt.Fprintf(buf, `Plugins
+
+Plugins are executables on the PATH whose names start with %q.
+A plugin named "%sfoo" is run by "%s foo", with any arguments that
+follow. Plugins must describe themselves when given --description. A
+plugin that ends its description with a line holding --describe-json is
+also run with that flag, and may then give its purpose, args, doc and
+category as a JSON object with "purpose", "args", "doc" and "category" keys.
+
+`, c.pluginPrefix, c.pluginPrefix, c.Name)
+	var plugins []Plugin
+	longest := 0
+	for _, plugin := range FindPlugins(ctx, c.pluginPrefix) {
+		// Plugins cannot replace registered subcommands.
+		if _, found := c.subcmds[plugin.Name]; found {
+			continue
+		}
+		if len(plugin.Name) > longest {
+			longest = len(plugin.Name)
+		}
+		plugins = append(plugins, plugin)
+	}
+	if len(plugins) == 0 {
+		fmt.Fprintf(buf, "No plugins found.\n")
+	}
+	descriptions := DescribePlugins(ctx, plugins, c.pluginCacheFile, c.pluginTimeout)
+	for i, plugin := range plugins {
+		fmt.Fprintf(buf, "%-*s  %s\n", longest, plugin.Name, descriptions[i])
+	}
+	return buf.String()
+}
+
+// pluginDirs returns the directories on the PATH held by ctx.Env, with
+// relative directories interpreted as relative to ctx.Dir.
+func pluginDirs(ctx *Context) []string {
+	var dirs []string
+	for _, dir := range filepath.SplitList(ctx.Getenv("PATH")) {
+		if dir == "" {
+			dir = "."
+		}
+		dirs = append(dirs, ctx.AbsPath(dir))
+	}
+	return dirs
+}
+
+// isExecutable reports whether info describes an executable file.
+func isExecutable(info os.FileInfo) bool {
+	return info.Mode().IsRegular() && info.Mode().Perm()&0111 != 0
+}
+
+// pluginsByName sorts plugins by name.
+type pluginsByName []Plugin
+
+func (p pluginsByName) Len() int           { return len(p) }
+func (p pluginsByName) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p pluginsByName) Less(i, j int) bool { return p[i].Name < p[j].Name }
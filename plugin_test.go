@@ -0,0 +1,236 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type PluginSuite struct {
+	gitjujutesting.IsolationSuite
+	dir1 string
+	dir2 string
+}
+
+var _ = gc.Suite(&PluginSuite{})
+
+func (s *PluginSuite) SetUpTest(c *gc.C) {
+	s.IsolationSuite.SetUpTest(c)
+	s.dir1 = c.MkDir()
+	s.dir2 = c.MkDir()
+	s.writePlugin(c, s.dir1, "jujutest-foo", "foo plugin", `echo foo "$@"; pwd; echo "$GREETING"`)
+	s.writePlugin(c, s.dir1, "jujutest-fail", "fail plugin", "echo failing >&2; exit 3")
+	s.writePlugin(c, s.dir2, "jujutest-foo", "shadowed foo plugin", "echo shadowed")
+	s.writePlugin(c, s.dir2, "jujutest-bar", "", "exit 1")
+	s.writePlugin(c, s.dir2, "other-baz", "other plugin", "exit 0")
+	err := ioutil.WriteFile(filepath.Join(s.dir2, "jujutest-data"), []byte("not executable"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+// writePlugin writes an executable shell script to dir that prints the
+// given description when run with --description, and otherwise runs
+// script.
+func (s *PluginSuite) writePlugin(c *gc.C, dir, name, description, script string) {
+	content := "#!/bin/sh\n"
+	if description != "" {
+		content += `if [ "$1" = "--description" ]; then echo "` + description + `"; exit 0; fi` + "\n"
+	}
+	content += script + "\n"
+	err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0755)
+	c.Assert(err, jc.ErrorIsNil)
+}
+
+func (s *PluginSuite) context(c *gc.C) *cmd.Context {
+	ctx := cmdtesting.Context(c)
+	ctx.Env = map[string]string{
+		"PATH":     s.dir1 + string(os.PathListSeparator) + s.dir2,
+		"GREETING": "hello",
+	}
+	return ctx
+}
+
+// pluginParams holds the parameters of the SuperCommands that the plugin
+// tests run. Their bar command shadows the jujutest-bar plugin.
+var pluginParams = cmd.SuperCommandParams{
+	Name:         "jujutest",
+	PluginPrefix: "jujutest-",
+}
+
+func (s *PluginSuite) TestFindPlugins(c *gc.C) {
+	plugins := cmd.FindPlugins(s.context(c), "jujutest-")
+	c.Assert(plugins, jc.DeepEquals, []cmd.Plugin{
+		{Name: "bar", Path: filepath.Join(s.dir2, "jujutest-bar")},
+		{Name: "fail", Path: filepath.Join(s.dir1, "jujutest-fail")},
+		{Name: "foo", Path: filepath.Join(s.dir1, "jujutest-foo")},
+	})
+}
+
+func (s *PluginSuite) TestLookPlugin(c *gc.C) {
+	plugin, err := cmd.LookPlugin(s.context(c), "jujutest-", "foo")
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(plugin, gc.Equals, cmd.Plugin{Name: "foo", Path: filepath.Join(s.dir1, "jujutest-foo")})
+	_, err = cmd.LookPlugin(s.context(c), "jujutest-", "data")
+	c.Check(err, gc.ErrorMatches, `plugin "jujutest-data" not found`)
+	_, err = cmd.LookPlugin(s.context(c), "jujutest-", "../other-baz")
+	c.Check(err, gc.ErrorMatches, `invalid plugin name "../other-baz"`)
+}
+
+func (s *PluginSuite) TestRunPlugin(c *gc.C) {
+	ctx := s.context(c)
+	code := cmd.Main(newTestSuper(pluginParams), ctx, []string{"foo", "--arg", "value"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "foo --arg value\n"+ctx.Dir+"\nhello\n")
+}
+
+func (s *PluginSuite) TestRunPluginExitCode(c *gc.C) {
+	ctx := s.context(c)
+	code := cmd.Main(newTestSuper(pluginParams), ctx, []string{"fail"})
+	c.Check(code, gc.Equals, 3)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "failing\n")
+}
+
+func (s *PluginSuite) TestUnknownCommand(c *gc.C) {
+	super := newTestSuper(pluginParams)
+	err := cmdtesting.InitCommand(super, []string{"data"})
+	c.Assert(err, jc.ErrorIsNil)
+	err = super.Run(s.context(c))
+	checkRunError(c, err, "unrecognized command: jujutest data")
+}
+
+func (s *PluginSuite) TestHelpPlugins(c *gc.C) {
+	ctx := s.context(c)
+	code := cmd.Main(newTestSuper(pluginParams), ctx, []string{"help", "plugins"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+Plugins
+
+Plugins are executables on the PATH whose names start with "jujutest-".
+A plugin named "jujutest-foo" is run by "jujutest foo", with any arguments that
+follow. Plugins must describe themselves when given --description. A
+plugin that ends its description with a line holding --describe-json is
+also run with that flag, and may then give its purpose, args, doc and
+category as a JSON object with "purpose", "args", "doc" and "category" keys.
+
+fail  fail plugin
+foo   foo plugin
+`[1:])
+
+	ctx = cmdtesting.Context(c)
+	code = cmd.Main(newTestSuper(pluginParams), ctx, []string{"help", "plugins"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), jc.HasSuffix, "\n\nNo plugins found.\n")
+}
+
+func (s *PluginSuite) writeJSONPlugin(c *gc.C) {
+	s.writePlugin(c, s.dir1, "jujutest-greet", "", `
+if [ "$1" = "--description" ]; then
+	echo "greet"
+	echo "--describe-json"
+	exit 0
+fi
+if [ "$1" = "--describe-json" ]; then
+	echo '{"purpose": "greet someone", "args": "<name>", "doc": "Greet the named person.", "category": "social"}'
+	exit 0
+fi
+echo greet "$@"`)
+}
+
+func (s *PluginSuite) TestHelpCommandsListsPlugins(c *gc.C) {
+	s.writeJSONPlugin(c)
+	ctx := s.context(c)
+	code := cmd.Main(newTestSuper(pluginParams), ctx, []string{"help", "commands"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+social commands:
+greet         greet someone (plugin)
+
+other commands:
+bar           bar functions
+bar-foo       alias for 'bar foo'
+defen         alias for 'defenestrate'
+defenestrate  defenestrate the juju
+fail          fail plugin (plugin)
+foo           foo plugin (plugin)
+help          show help on a command or other topic
+throw         alias for 'defenestrate'
+`[1:])
+
+	ctx = s.context(c)
+	code = cmd.Main(newTestSuper(pluginParams), ctx, []string{"help"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), jc.Contains, "    greet        - greet someone (plugin)\n")
+}
+
+func (s *PluginSuite) TestHelpPlugin(c *gc.C) {
+	s.writeJSONPlugin(c)
+	ctx := s.context(c)
+	code := cmd.Main(newTestSuper(pluginParams), ctx, []string{"help", "greet"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, `
+Usage: jujutest greet <name>
+
+Summary:
+greet someone
+
+Details:
+Greet the named person.
+`[1:])
+
+	// Plugins that do not describe themselves in JSON give their own help,
+	// along with any nested args.
+	ctx = s.context(c)
+	code = cmd.Main(newTestSuper(pluginParams), ctx, []string{"help", "foo", "sub"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "foo --help sub\n"+ctx.Dir+"\nhello\n")
+}
+
+func (s *PluginSuite) TestHelpNestedPlugin(c *gc.C) {
+	super := newTestSuper(pluginParams)
+	super.Register(cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:         "model",
+		UsagePrefix:  "jujutest",
+		PluginPrefix: "jujutest-",
+	}))
+	ctx := s.context(c)
+	code := cmd.Main(super, ctx, []string{"help", "model", "foo", "sub"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "foo --help sub\n"+ctx.Dir+"\nhello\n")
+
+	s.writeJSONPlugin(c)
+	ctx = s.context(c)
+	code = cmd.Main(super, ctx, []string{"help", "model", "gret"})
+	c.Check(code, gc.Equals, 1)
+	c.Check(c.GetTestLog(), jc.Contains, `ERROR cmd subcommand "gret" not found (did you mean "greet"?)`)
+}
+
+func (s *PluginSuite) TestCompletePlugins(c *gc.C) {
+	params := pluginParams
+	params.Completion = true
+	ctx := s.context(c)
+	code := cmd.Main(newTestSuper(params), ctx, []string{"__complete", "f"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "fail\nfoo\n")
+}
+
+func (s *PluginSuite) TestInfoDoesNotRunPlugins(c *gc.C) {
+	argsFile := filepath.Join(c.MkDir(), "args")
+	s.writePlugin(c, s.dir1, "jujutest-record", "", `echo "$@" >> `+argsFile)
+	super := newTestSuper(pluginParams)
+	ctx := s.context(c)
+	code := cmd.Main(super, ctx, []string{"--description"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), gc.Equals, "jujutest: no description available\n")
+	c.Check(super.Info().Doc, gc.Not(jc.Contains), "record")
+	_, err := os.Stat(argsFile)
+	c.Check(os.IsNotExist(err), jc.IsTrue)
+}
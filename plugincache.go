@@ -0,0 +1,264 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	goyaml "gopkg.in/yaml.v2"
+)
+
+// DefaultPluginTimeout holds how long a plugin is given to describe
+// itself when no other timeout is specified.
+const DefaultPluginTimeout = 5 * time.Second
+
+// describeJSONFlag is the flag that asks a plugin to describe itself in
+// JSON. Plugins that support it say so by ending their --description
+// output with a line holding the flag.
+const describeJSONFlag = "--describe-json"
+
+// errPluginTimeout is returned by probe when a plugin takes too long to
+// describe itself.
+var errPluginTimeout = errors.New("plugin timed out")
+
+// DescribePlugins returns the descriptions of the given plugins, in the
+// same order. The plugins are probed concurrently, as described for
+// pluginInfo, and any that fail or take longer than timeout are
+// described as such. If cacheFile is not empty, descriptions are read
+// from and saved to it, keyed by the path, size and modification time of
+// each plugin, so that plugins are only run again when they change.
+func DescribePlugins(ctx *Context, plugins []Plugin, cacheFile string, timeout time.Duration) []string {
+	infos := pluginInfos(ctx, plugins, cacheFile, timeout)
+	descriptions := make([]string, len(infos))
+	for i, info := range infos {
+		descriptions[i] = info.Purpose
+	}
+	return descriptions
+}
+
+// pluginInfos returns the details of the given plugins, in the same
+// order, as described for DescribePlugins.
+func pluginInfos(ctx *Context, plugins []Plugin, cacheFile string, timeout time.Duration) []pluginInfo {
+	if timeout <= 0 {
+		timeout = DefaultPluginTimeout
+	}
+	var cache, updated pluginCache
+	if cacheFile != "" {
+		cache = readPluginCache(cacheFile)
+		updated = make(pluginCache)
+	}
+	infos := make([]pluginInfo, len(plugins))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, plugin := range plugins {
+		info, err := os.Stat(plugin.Path)
+		if err != nil {
+			infos[i] = pluginInfo{Purpose: plugin.failure(err)}
+			continue
+		}
+		if entry, ok := cache[plugin.Path]; ok && entry.matches(info) {
+			infos[i] = entry.pluginInfo
+			mu.Lock()
+			updated[plugin.Path] = entry
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(i int, plugin Plugin, info os.FileInfo) {
+			defer wg.Done()
+			described, err := plugin.probe(ctx, timeout)
+			if err != nil {
+				infos[i] = pluginInfo{Purpose: plugin.failure(err)}
+				return
+			}
+			infos[i] = described
+			if updated != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				updated[plugin.Path] = newPluginCacheEntry(info, described)
+			}
+		}(i, plugin, info)
+	}
+	wg.Wait()
+	if cacheFile != "" && !updated.equals(cache) {
+		if err := writePluginCache(cacheFile, updated); err != nil {
+			logger.Debugf("cannot write plugin cache: %v", err)
+		}
+	}
+	return infos
+}
+
+// pluginInfo holds the details of a plugin, as written in JSON by plugins
+// that support the --describe-json flag.
+type pluginInfo struct {
+	Purpose  string `json:"purpose" yaml:"description"`
+	Args     string `json:"args,omitempty" yaml:"args,omitempty"`
+	Doc      string `json:"doc,omitempty" yaml:"doc,omitempty"`
+	Category string `json:"category,omitempty" yaml:"category,omitempty"`
+}
+
+// probe returns the details of the plugin. The output of the plugin when
+// run with --description is used as its purpose, unless the plugin says
+// that it supports the --describe-json flag, in which case it is run
+// again to describe itself in JSON. Other plugins are never given that
+// flag, since they might not recognize it. If the plugin does not finish
+// within the timeout, it is killed and probe returns errPluginTimeout.
+func (p Plugin) probe(ctx *Context, timeout time.Duration) (pluginInfo, error) {
+	var info pluginInfo
+	description, err := p.output(ctx, timeout, "--description")
+	if err != nil {
+		return info, err
+	}
+	lines := strings.Split(description, "\n")
+	if strings.TrimSpace(lines[len(lines)-1]) != describeJSONFlag {
+		info.Purpose = description
+		return info, nil
+	}
+	info.Purpose = strings.TrimSpace(strings.Join(lines[:len(lines)-1], "\n"))
+	output, err := p.output(ctx, timeout, describeJSONFlag)
+	var described pluginInfo
+	if err == nil {
+		err = json.Unmarshal([]byte(output), &described)
+	}
+	if err != nil || described.Purpose == "" {
+		// Fall back to the plain description.
+		logger.Debugf("%s %s failed: %v", p.Path, describeJSONFlag, err)
+		return info, nil
+	}
+	return described, nil
+}
+
+// output runs the plugin with the given flag and returns its output. If
+// the plugin does not finish within the timeout, it is killed and output
+// returns errPluginTimeout.
+func (p Plugin) output(ctx *Context, timeout time.Duration, flag string) (string, error) {
+	stdctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	var stdout, stderr bytes.Buffer
+	command := p.command(ctx, stdctx, []string{flag})
+	command.Stdout = &stdout
+	command.Stderr = &stderr
+	if err := command.Start(); err != nil {
+		return "", err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- command.Wait()
+	}()
+	var err error
+	select {
+	case err = <-done:
+	case <-stdctx.Done():
+		// The plugin has been killed, but processes that it started
+		// may still hold its output open, so don't wait for them.
+	}
+	switch {
+	case stdctx.Err() == context.DeadlineExceeded:
+		return "", errPluginTimeout
+	case stdctx.Err() != nil:
+		return "", stdctx.Err()
+	case err != nil:
+		return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// failure returns the description of a plugin that could not describe
+// itself because of err.
+func (p Plugin) failure(err error) string {
+	logger.Debugf("cannot describe %s: %v", p.Path, err)
+	if err == errPluginTimeout {
+		return fmt.Sprintf("timed out running '%s --description'", filepath.Base(p.Path))
+	}
+	return fmt.Sprintf("error occurred running '%s --description'", filepath.Base(p.Path))
+}
+
+// pluginCache holds the descriptions of plugins, keyed by path.
+type pluginCache map[string]pluginCacheEntry
+
+// pluginCacheEntry holds the details of a plugin, along with the size
+// and modification time of the plugin when it was described.
+type pluginCacheEntry struct {
+	Size       int64 `yaml:"size"`
+	ModTime    int64 `yaml:"mtime"`
+	pluginInfo `yaml:",inline"`
+}
+
+func newPluginCacheEntry(info os.FileInfo, described pluginInfo) pluginCacheEntry {
+	return pluginCacheEntry{
+		Size:       info.Size(),
+		ModTime:    info.ModTime().UnixNano(),
+		pluginInfo: described,
+	}
+}
+
+// matches reports whether the entry describes the plugin file that info
+// describes.
+func (e pluginCacheEntry) matches(info os.FileInfo) bool {
+	return e.Size == info.Size() && e.ModTime == info.ModTime().UnixNano()
+}
+
+// equals reports whether c and other hold the same entries.
+func (c pluginCache) equals(other pluginCache) bool {
+	if len(c) != len(other) {
+		return false
+	}
+	for path, entry := range c {
+		if otherEntry, ok := other[path]; !ok || otherEntry != entry {
+			return false
+		}
+	}
+	return true
+}
+
+// readPluginCache returns the plugin descriptions held in the named
+// file. A missing or invalid file holds no descriptions.
+func readPluginCache(filename string) pluginCache {
+	cache := make(pluginCache)
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Debugf("cannot read plugin cache: %v", err)
+		}
+		return cache
+	}
+	if err := goyaml.Unmarshal(data, &cache); err != nil {
+		logger.Debugf("cannot parse plugin cache %q: %v", filename, err)
+		return make(pluginCache)
+	}
+	return cache
+}
+
+// writePluginCache replaces the named file with one holding the plugin
+// descriptions in cache.
+func writePluginCache(filename string, cache pluginCache) (err error) {
+	data, err := goyaml.Marshal(cache)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+	out, err := (&Output{}).openFile(filename)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if closeErr := out.close(err == nil); err == nil {
+			err = closeErr
+		}
+	}()
+	_, err = out.Write(data)
+	return err
+}
@@ -0,0 +1,116 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+func (s *PluginSuite) TestDescribePlugins(c *gc.C) {
+	s.writePlugin(c, s.dir1, "jujutest-hang", "", "while :; do :; done")
+	ctx := s.context(c)
+	plugins := cmd.FindPlugins(ctx, "jujutest-")
+	start := time.Now()
+	descriptions := cmd.DescribePlugins(ctx, plugins, "", 500*time.Millisecond)
+	c.Check(time.Since(start) < 5*time.Second, jc.IsTrue)
+	c.Check(descriptions, jc.DeepEquals, []string{
+		"error occurred running 'jujutest-bar --description'",
+		"fail plugin",
+		"foo plugin",
+		"timed out running 'jujutest-hang --description'",
+	})
+}
+
+func (s *PluginSuite) TestDescribePluginsJSON(c *gc.C) {
+	// Plugins are only given --describe-json if they say they support it.
+	argsFile := filepath.Join(c.MkDir(), "args")
+	s.writePlugin(c, s.dir1, "jujutest-record", "record plugin", `echo "$@" >> `+argsFile)
+	s.writePlugin(c, s.dir1, "jujutest-bad", "", `
+if [ "$1" = "--description" ]; then
+	printf "bad plugin\n--describe-json\n"
+	exit 0
+fi
+echo "not json"`)
+	s.writeJSONPlugin(c)
+	ctx := s.context(c)
+	plugins := []cmd.Plugin{
+		{Name: "record", Path: filepath.Join(s.dir1, "jujutest-record")},
+		{Name: "bad", Path: filepath.Join(s.dir1, "jujutest-bad")},
+		{Name: "greet", Path: filepath.Join(s.dir1, "jujutest-greet")},
+	}
+	descriptions := cmd.DescribePlugins(ctx, plugins, "", 0)
+	c.Check(descriptions, jc.DeepEquals, []string{"record plugin", "bad plugin", "greet someone"})
+	_, err := os.Stat(argsFile)
+	c.Check(os.IsNotExist(err), jc.IsTrue)
+}
+
+func (s *PluginSuite) TestDescribePluginsCache(c *gc.C) {
+	cacheFile := filepath.Join(c.MkDir(), "cache", "plugins.yaml")
+	ctx := s.context(c)
+	plugins := []cmd.Plugin{
+		{Name: "foo", Path: filepath.Join(s.dir1, "jujutest-foo")},
+		{Name: "bar", Path: filepath.Join(s.dir2, "jujutest-bar")},
+	}
+	descriptions := cmd.DescribePlugins(ctx, plugins, cacheFile, 0)
+	c.Assert(descriptions, jc.DeepEquals, []string{
+		"foo plugin",
+		"error occurred running 'jujutest-bar --description'",
+	})
+	_, err := os.Stat(cacheFile)
+	c.Assert(err, jc.ErrorIsNil)
+
+	// A plugin with the same size and modification time is not run again.
+	path := plugins[0].Path
+	info, err := os.Stat(path)
+	c.Assert(err, jc.ErrorIsNil)
+	s.writePlugin(c, s.dir1, "jujutest-foo", "FOO plugin", `echo foo "$@"; pwd; echo "$GREETING"`)
+	err = os.Chtimes(path, info.ModTime(), info.ModTime())
+	c.Assert(err, jc.ErrorIsNil)
+	descriptions = cmd.DescribePlugins(ctx, plugins[:1], cacheFile, 0)
+	c.Check(descriptions, jc.DeepEquals, []string{"foo plugin"})
+
+	// Once the plugin is modified, it is run again.
+	modified := info.ModTime().Add(time.Second)
+	err = os.Chtimes(path, modified, modified)
+	c.Assert(err, jc.ErrorIsNil)
+	descriptions = cmd.DescribePlugins(ctx, plugins[:1], cacheFile, 0)
+	c.Check(descriptions, jc.DeepEquals, []string{"FOO plugin"})
+}
+
+func (s *PluginSuite) TestDescribePluginsInvalidCache(c *gc.C) {
+	cacheFile := filepath.Join(c.MkDir(), "plugins.yaml")
+	err := ioutil.WriteFile(cacheFile, []byte("not: [valid"), 0644)
+	c.Assert(err, jc.ErrorIsNil)
+	plugins := []cmd.Plugin{{Name: "foo", Path: filepath.Join(s.dir1, "jujutest-foo")}}
+	descriptions := cmd.DescribePlugins(s.context(c), plugins, cacheFile, 0)
+	c.Check(descriptions, jc.DeepEquals, []string{"foo plugin"})
+}
+
+func (s *PluginSuite) TestHelpPluginsTimeout(c *gc.C) {
+	s.writePlugin(c, s.dir1, "jujutest-hang", "", "while :; do :; done")
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:            "jujutest",
+		PluginPrefix:    "jujutest-",
+		PluginCacheFile: filepath.Join(c.MkDir(), "plugins.yaml"),
+		PluginTimeout:   500 * time.Millisecond,
+	})
+	ctx := s.context(c)
+	code := cmd.Main(super, ctx, []string{"help", "plugins"})
+	c.Check(code, gc.Equals, 0)
+	c.Check(cmdtesting.Stdout(ctx), jc.HasSuffix, `
+bar   error occurred running 'jujutest-bar --description'
+fail  fail plugin
+foo   foo plugin
+hang  timed out running 'jujutest-hang --description'
+`)
+}
@@ -0,0 +1,119 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// These environment variables pass the context of a SuperCommand to the
+// commands that its MissingCallback runs, such as plugins. They are set
+// in the Env of the Context passed to the callback, replacing any that
+// were inherited. See ReadPluginEnv.
+const (
+	// PluginEnvCommand holds the command that ran the plugin, including
+	// any usage prefix; for example "juju" or "juju model".
+	PluginEnvCommand = "CMD_PLUGIN_COMMAND"
+
+	// PluginEnvDir holds the working directory of the command.
+	PluginEnvDir = "CMD_PLUGIN_DIR"
+
+	// The remaining variables hold the logging settings given to the
+	// command, and are only set if it has a Log. Flags are "true" or
+	// "false", and the log file path, if set, is absolute.
+	PluginEnvLogFile       = "CMD_PLUGIN_LOG_FILE"
+	PluginEnvLoggingConfig = "CMD_PLUGIN_LOGGING_CONFIG"
+	PluginEnvVerbose       = "CMD_PLUGIN_VERBOSE"
+	PluginEnvQuiet         = "CMD_PLUGIN_QUIET"
+	PluginEnvDebug         = "CMD_PLUGIN_DEBUG"
+	PluginEnvShowLog       = "CMD_PLUGIN_SHOW_LOG"
+)
+
+// pluginLogFlags maps the environment variables holding the logging flags
+// passed to a plugin to the fields of a Log.
+var pluginLogFlags = map[string]func(log *Log) *bool{
+	PluginEnvVerbose: func(log *Log) *bool { return &log.Verbose },
+	PluginEnvQuiet:   func(log *Log) *bool { return &log.Quiet },
+	PluginEnvDebug:   func(log *Log) *bool { return &log.Debug },
+	PluginEnvShowLog: func(log *Log) *bool { return &log.ShowLog },
+}
+
+// PluginEnv holds the context passed to a plugin by the command that
+// runs it.
+type PluginEnv struct {
+	// Command holds the command that ran the plugin.
+	Command string
+
+	// Dir holds the working directory of the command.
+	Dir string
+
+	// Log holds the logging settings given to the command, or nil if
+	// the command has no Log.
+	Log *Log
+}
+
+// ReadPluginEnv returns the context passed to a plugin in ctx.Env by the
+// command that runs it, and sets ctx.Dir to the command's directory. The
+// returned Log may be started in ctx so that the plugin logs as the
+// command would. An error is returned if ctx.Env does not hold a context.
+func ReadPluginEnv(ctx *Context) (*PluginEnv, error) {
+	command := ctx.Getenv(PluginEnvCommand)
+	if command == "" {
+		return nil, fmt.Errorf("$%s not set: not run as a plugin", PluginEnvCommand)
+	}
+	env := &PluginEnv{
+		Command: command,
+		Dir:     ctx.Getenv(PluginEnvDir),
+	}
+	if _, ok := ctx.Env[PluginEnvLoggingConfig]; ok {
+		env.Log = &Log{
+			Path:   ctx.Getenv(PluginEnvLogFile),
+			Config: ctx.Getenv(PluginEnvLoggingConfig),
+		}
+		for key, field := range pluginLogFlags {
+			if ctx.Getenv(key) == "" {
+				continue
+			}
+			value, err := strconv.ParseBool(ctx.Getenv(key))
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q for $%s", ctx.Getenv(key), key)
+			}
+			*field(env.Log) = value
+		}
+	}
+	if env.Dir != "" {
+		ctx.Dir = env.Dir
+	}
+	return env, nil
+}
+
+// pluginContext returns a copy of ctx for running commands on behalf of
+// the named command, with an Env that passes them the command's context
+// as described by ReadPluginEnv.
+func pluginContext(ctx *Context, command string) *Context {
+	pluginCtx := *ctx
+	pluginCtx.Env = make(map[string]string)
+	for key, value := range ctx.Env {
+		pluginCtx.Env[key] = value
+	}
+	for _, key := range []string{PluginEnvLogFile, PluginEnvLoggingConfig} {
+		delete(pluginCtx.Env, key)
+	}
+	for key := range pluginLogFlags {
+		delete(pluginCtx.Env, key)
+	}
+	pluginCtx.Env[PluginEnvCommand] = command
+	pluginCtx.Env[PluginEnvDir] = ctx.Dir
+	if log := ctx.log; log != nil {
+		if log.Path != "" {
+			pluginCtx.Env[PluginEnvLogFile] = ctx.AbsPath(log.Path)
+		}
+		pluginCtx.Env[PluginEnvLoggingConfig] = log.Config
+		for key, field := range pluginLogFlags {
+			pluginCtx.Env[key] = strconv.FormatBool(*field(log))
+		}
+	}
+	return &pluginCtx
+}
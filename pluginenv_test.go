@@ -0,0 +1,116 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"path/filepath"
+
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type PluginEnvSuite struct {
+	gitjujutesting.LoggingSuite
+}
+
+var _ = gc.Suite(&PluginEnvSuite{})
+
+// runPlugin runs a SuperCommand with the given args, and returns the
+// Context passed to the MissingCallback of its "model" subcommand.
+func (s *PluginEnvSuite) runPlugin(c *gc.C, log *cmd.Log, args ...string) *cmd.Context {
+	var pluginCtx *cmd.Context
+	super := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		Log:  log,
+	})
+	super.Register(cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:        "model",
+		UsagePrefix: "jujutest",
+		MissingCallback: func(ctx *cmd.Context, subcommand string, args []string) error {
+			pluginCtx = ctx
+			return nil
+		},
+	}))
+	ctx := cmdtesting.Context(c)
+	ctx.Env = map[string]string{
+		"HOME":             "/home/user",
+		cmd.PluginEnvDebug: "true",
+	}
+	code := cmd.Main(super, ctx, args)
+	c.Assert(code, gc.Equals, 0)
+	c.Assert(pluginCtx, gc.NotNil)
+	// The command's own environment is unchanged.
+	c.Check(ctx.Env, jc.DeepEquals, map[string]string{
+		"HOME":             "/home/user",
+		cmd.PluginEnvDebug: "true",
+	})
+	return pluginCtx
+}
+
+func (s *PluginEnvSuite) TestEnv(c *gc.C) {
+	pluginCtx := s.runPlugin(c, &cmd.Log{}, "--verbose", "--log-file", "test.log", "--logging-config", "<root>=INFO", "model", "foo")
+	c.Check(pluginCtx.Env, jc.DeepEquals, map[string]string{
+		"HOME":                     "/home/user",
+		cmd.PluginEnvCommand:       "jujutest model",
+		cmd.PluginEnvDir:           pluginCtx.Dir,
+		cmd.PluginEnvLogFile:       filepath.Join(pluginCtx.Dir, "test.log"),
+		cmd.PluginEnvLoggingConfig: "<root>=INFO",
+		cmd.PluginEnvVerbose:       "true",
+		cmd.PluginEnvQuiet:         "false",
+		cmd.PluginEnvDebug:         "false",
+		cmd.PluginEnvShowLog:       "false",
+	})
+}
+
+func (s *PluginEnvSuite) TestEnvWithoutLog(c *gc.C) {
+	pluginCtx := s.runPlugin(c, nil, "model", "foo")
+	c.Check(pluginCtx.Env, jc.DeepEquals, map[string]string{
+		"HOME":               "/home/user",
+		cmd.PluginEnvCommand: "jujutest model",
+		cmd.PluginEnvDir:     pluginCtx.Dir,
+	})
+}
+
+func (s *PluginEnvSuite) TestReadPluginEnv(c *gc.C) {
+	pluginCtx := s.runPlugin(c, &cmd.Log{}, "--quiet", "--log-file", "test.log", "model", "foo")
+	ctx := cmdtesting.Context(c)
+	ctx.Env = pluginCtx.Env
+	env, err := cmd.ReadPluginEnv(ctx)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(env, jc.DeepEquals, &cmd.PluginEnv{
+		Command: "jujutest model",
+		Dir:     pluginCtx.Dir,
+		Log: &cmd.Log{
+			Path:  filepath.Join(pluginCtx.Dir, "test.log"),
+			Quiet: true,
+		},
+	})
+	c.Check(ctx.Dir, gc.Equals, pluginCtx.Dir)
+}
+
+func (s *PluginEnvSuite) TestReadPluginEnvWithoutLog(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	ctx.Env = map[string]string{cmd.PluginEnvCommand: "jujutest"}
+	env, err := cmd.ReadPluginEnv(ctx)
+	c.Assert(err, jc.ErrorIsNil)
+	c.Check(env, jc.DeepEquals, &cmd.PluginEnv{Command: "jujutest"})
+}
+
+func (s *PluginEnvSuite) TestReadPluginEnvErrors(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	_, err := cmd.ReadPluginEnv(ctx)
+	c.Check(err, gc.ErrorMatches, `\$CMD_PLUGIN_COMMAND not set: not run as a plugin`)
+
+	ctx.Env = map[string]string{
+		cmd.PluginEnvCommand:       "jujutest",
+		cmd.PluginEnvLoggingConfig: "",
+		cmd.PluginEnvVerbose:       "yes please",
+	}
+	_, err = cmd.ReadPluginEnv(ctx)
+	c.Check(err, gc.ErrorMatches, `invalid value "yes please" for \$CMD_PLUGIN_VERBOSE`)
+}
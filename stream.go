@@ -0,0 +1,172 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+)
+
+// OutputStream writes a sequence of values, or records, to the target
+// chosen by the --output flag, formatting each one as soon as it is
+// written. This suits commands that produce their results progressively,
+// such as watchers. With --format json each record is written on its
+// own line (JSON Lines); with yaml each record is a document, and
+// documents are separated by "---"; with tabular the rows of every
+// record share a single header, and keep the column widths of the first
+// record, truncating wider cells. Other formats write each record as
+// Output.Write would.
+type OutputStream struct {
+	output  *Output
+	target  io.Writer
+	close   func(commit bool) error
+	tabular *tabularStream
+	written int
+	failed  bool
+}
+
+// Stream opens the target chosen by the --output flag and returns an
+// OutputStream that writes to it. The stream must be closed when the
+// command has finished writing to it, typically by deferring Close in
+// Run; an --output file is not replaced until then.
+func (c *Output) Stream(ctx *Context) (*OutputStream, error) {
+	var tabular *tabularStream
+	if c.formatter.name == "tabular" {
+		tabular = &tabularStream{
+			columns: c.columnNames(),
+			headers: !c.noHeaders,
+		}
+	}
+	target, closeTarget, err := c.openTarget(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &OutputStream{
+		output:  c,
+		target:  target,
+		close:   closeTarget,
+		tabular: tabular,
+	}, nil
+}
+
+// Write formats value and writes it to the stream.
+func (s *OutputStream) Write(value interface{}) error {
+	var bytes []byte
+	var err error
+	if s.tabular != nil {
+		bytes, err = s.tabular.format(value)
+	} else {
+		bytes, err = s.output.format(value)
+	}
+	if err == nil && len(bytes) > 0 {
+		if s.written > 0 && s.output.formatter.name == "yaml" {
+			bytes = append([]byte("---\n"), bytes...)
+		}
+		s.written++
+		_, err = s.target.Write(append(bytes, '\n'))
+	}
+	if err != nil {
+		s.failed = true
+	}
+	return err
+}
+
+// Close closes the stream's target. It does not close standard output.
+// If any record failed to be written, an --output file is left as it
+// was before the stream was opened, unless it is being appended to.
+func (s *OutputStream) Close() error {
+	return s.close(!s.failed)
+}
+
+// tabularStream formats records for an OutputStream with the "tabular"
+// format. The columns are those of the first record that can be
+// represented as a table; later records that lack any of them leave
+// those cells empty. The columns keep the widths of the first record, so
+// that later rows line up with those already written; since those rows
+// cannot be changed, a later cell wider than its column is truncated,
+// ending in "…". The last column is never truncated.
+type tabularStream struct {
+	// columns holds the columns chosen with --columns, if any.
+	columns []string
+	// headers is true if the header row should be written.
+	headers bool
+	// names holds the headers of the columns being written, once the
+	// first table has been seen.
+	names  []string
+	widths []int
+}
+
+// format returns the lines for the rows of value.
+func (t *tabularStream) format(value interface{}) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	table, ok := tabulate(reflect.ValueOf(value))
+	if !ok {
+		return formatTabular(value, t.columns, t.headers)
+	}
+	var lines [][]string
+	if t.names == nil {
+		if len(t.columns) > 0 {
+			var err error
+			if table, err = table.selectColumns(t.columns); err != nil {
+				return nil, err
+			}
+		}
+		t.names = table.headers
+		if t.headers {
+			lines = append(lines, t.names)
+		}
+	}
+	index := make(map[string]int)
+	for i, header := range table.headers {
+		index[header] = i
+	}
+	for _, row := range table.rows {
+		cells := make([]string, len(t.names))
+		for i, name := range t.names {
+			if j, ok := index[name]; ok {
+				cells[i] = row[j]
+			}
+		}
+		lines = append(lines, cells)
+	}
+	if t.widths == nil {
+		t.widths = make([]int, len(t.names))
+		for _, cells := range lines {
+			for i, cell := range cells {
+				if width := utf8.RuneCountInString(cell); width > t.widths[i] {
+					t.widths[i] = width
+				}
+			}
+		}
+	}
+	var out []string
+	for _, cells := range lines {
+		var line string
+		for i, cell := range cells {
+			if i < len(cells)-1 {
+				cell = truncateCell(cell, t.widths[i])
+				cell += strings.Repeat(" ", t.widths[i]-utf8.RuneCountInString(cell)+2)
+			}
+			line += cell
+		}
+		out = append(out, strings.TrimRight(line, " "))
+	}
+	return []byte(strings.Join(out, "\n")), nil
+}
+
+// truncateCell returns cell, shortened to width runes if it is wider.
+func truncateCell(cell string, width int) string {
+	runes := []rune(cell)
+	if len(runes) <= width {
+		return cell
+	}
+	if width == 0 {
+		return "…"
+	}
+	return string(runes[:width-1]) + "…"
+}
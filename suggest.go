@@ -0,0 +1,153 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"launchpad.net/gnuflag"
+)
+
+// maxSuggestions holds the largest number of suggestions offered for a
+// mistyped name.
+const maxSuggestions = 3
+
+// suggest returns the candidates that name may be a mistyping of,
+// closest first.
+func suggest(name string, candidates []string) []string {
+	// Names that are too short have no plausible corrections.
+	limit := len(name) / 3
+	var found []suggestion
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if d := editDistance(strings.ToLower(name), strings.ToLower(candidate)); d <= limit {
+			found = append(found, suggestion{candidate, d})
+		}
+	}
+	sort.Sort(byDistance(found))
+	var result []string
+	for i := 0; i < len(found) && i < maxSuggestions; i++ {
+		result = append(result, found[i].name)
+	}
+	return result
+}
+
+// suggestion holds a candidate name and its distance from a mistyped
+// name.
+type suggestion struct {
+	name     string
+	distance int
+}
+
+// byDistance sorts suggestions by distance, then by name.
+type byDistance []suggestion
+
+func (s byDistance) Len() int      { return len(s) }
+func (s byDistance) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s byDistance) Less(i, j int) bool {
+	if s[i].distance != s[j].distance {
+		return s[i].distance < s[j].distance
+	}
+	return s[i].name < s[j].name
+}
+
+// editDistance returns the number of single character insertions,
+// deletions, substitutions and transpositions of adjacent characters
+// needed to turn a into b.
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	// d[i][j] holds the distance between s[:i] and t[:j].
+	d := make([][]int, len(s)+1)
+	for i := range d {
+		d[i] = make([]int, len(t)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && s[i-1] == t[j-2] && s[i-2] == t[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(s)][len(t)]
+}
+
+// minInt returns the smallest of the given ints.
+func minInt(n int, others ...int) int {
+	for _, other := range others {
+		if other < n {
+			n = other
+		}
+	}
+	return n
+}
+
+// didYouMean returns text to append to an error message that offers
+// the given suggestions, or "" if there are none.
+func didYouMean(suggestions []string) string {
+	if len(suggestions) == 0 {
+		return ""
+	}
+	quoted := make([]string, len(suggestions))
+	for i, s := range suggestions {
+		quoted[i] = fmt.Sprintf("%q", s)
+	}
+	last := len(quoted) - 1
+	if last == 0 {
+		return fmt.Sprintf(" (did you mean %s?)", quoted[0])
+	}
+	return fmt.Sprintf(" (did you mean %s or %s?)", strings.Join(quoted[:last], ", "), quoted[last])
+}
+
+// undefinedFlagPrefix starts the message of the error that gnuflag
+// returns for an unknown flag.
+const undefinedFlagPrefix = "flag provided but not defined: "
+
+// suggestFlag returns err, the result of parsing f, with suggestions
+// added if it reports an unknown flag. If the flag is obsolete, the error
+// says so instead. Flags that are being phased out are not suggested.
+func suggestFlag(f *gnuflag.FlagSet, deprecations map[string]FlagDeprecation, err error) error {
+	if err == nil || !strings.HasPrefix(err.Error(), undefinedFlagPrefix) {
+		return err
+	}
+	name := strings.TrimLeft(strings.TrimPrefix(err.Error(), undefinedFlagPrefix), "-")
+	if d, ok := deprecations[name]; ok && d.Status == FlagObsolete {
+		return fmt.Errorf("%s", d.message(name))
+	}
+	var candidates []string
+	f.VisitAll(func(flag *gnuflag.Flag) {
+		if _, ok := deprecations[flag.Name]; !ok {
+			candidates = append(candidates, flag.Name)
+		}
+	})
+	suggestions := suggest(name, candidates)
+	if len(suggestions) == 0 {
+		return err
+	}
+	for i, s := range suggestions {
+		suggestions[i] = flagWithMinus(s)
+	}
+	return fmt.Errorf("%v%s", err, didYouMean(suggestions))
+}
+
+// flagWithMinus returns the flag name as it is given on the command
+// line.
+func flagWithMinus(name string) string {
+	if len(name) > 1 {
+		return "--" + name
+	}
+	return "-" + name
+}
@@ -0,0 +1,91 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd_test
+
+import (
+	"github.com/juju/loggo"
+	gitjujutesting "github.com/juju/testing"
+	jc "github.com/juju/testing/checkers"
+	gc "gopkg.in/check.v1"
+
+	"github.com/juju/cmd"
+	"github.com/juju/cmd/cmdtesting"
+)
+
+type SuggestSuite struct {
+	gitjujutesting.IsolationSuite
+}
+
+var _ = gc.Suite(&SuggestSuite{})
+
+func (s *SuggestSuite) TestCommands(c *gc.C) {
+	for i, test := range []struct {
+		args []string
+		err  string
+	}{{
+		args: []string{"defenstrate"},
+		err:  `unrecognized command: jujutest defenstrate \(did you mean "defenestrate"\?\)`,
+	}, {
+		args: []string{"THROW"},
+		err:  `unrecognized command: jujutest THROW \(did you mean "throw"\?\)`,
+	}, {
+		args: []string{"dfe"},
+		err:  `unrecognized command: jujutest dfe \(did you mean "def"\?\)`,
+	}, {
+		args: []string{"defe"},
+		err:  `unrecognized command: jujutest defe \(did you mean "def" or "defen"\?\)`,
+	}, {
+		args: []string{"old-thro"},
+		err:  `unrecognized command: jujutest old-thro`,
+	}, {
+		args: []string{"discombobulate"},
+		err:  `unrecognized command: jujutest discombobulate`,
+	}, {
+		args: []string{"bar", "fooo"},
+		err:  `unrecognized command: bar fooo \(did you mean "foo"\?\)`,
+	}, {
+		args: []string{"defenestrate", "--optoin", "x"},
+		err:  `flag provided but not defined: --optoin \(did you mean "--option"\?\)`,
+	}} {
+		c.Logf("test %d: %q", i, test.args)
+		err := cmdtesting.InitCommand(newTestSuper(aliasedParams(c)), test.args)
+		c.Check(err, gc.ErrorMatches, test.err)
+	}
+}
+
+func (s *SuggestSuite) TestMissingCallback(c *gc.C) {
+	// Suggestions are made once the callback fails to recognize the
+	// command.
+	sc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name: "jujutest",
+		MissingCallback: func(ctx *cmd.Context, subcommand string, args []string) error {
+			if subcommand == "depoly" {
+				return &cmd.UnrecognizedCommand{Name: subcommand}
+			}
+			return nil
+		},
+	})
+	sc.Register(&TestCommand{Name: "deploy"})
+	_, err := cmdtesting.RunCommand(c, sc, "depoly")
+	checkRunError(c, err, `unrecognized command: jujutest depoly (did you mean "deploy"?)`)
+}
+
+func (s *SuggestSuite) TestTopLevelFlags(c *gc.C) {
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(newTestSuper(aliasedParams(c)), ctx, []string{"--no-alais", "throw"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: flag provided but not defined: --no-alais (did you mean \"--no-alias\"?)\n")
+}
+
+func (s *SuggestSuite) TestHelp(c *gc.C) {
+	ctx, err := cmdtesting.RunCommand(c, newTestSuper(aliasedParams(c)), "help", "concpets")
+	c.Check(cmd.IsErrSilent(err), jc.IsTrue)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "ERROR unknown command or topic for concpets (did you mean \"concepts\" or \"concept\"?)\n")
+	loggo.ResetWriters()
+	ctx, err = cmdtesting.RunCommand(c, newTestSuper(aliasedParams(c)), "help", "defenestarte")
+	c.Check(cmd.IsErrSilent(err), jc.IsTrue)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "ERROR unknown command or topic for defenestarte (did you mean \"defenestrate\"?)\n")
+	err = cmdtesting.InitCommand(newTestSuper(aliasedParams(c)), []string{"help", "bar", "fooo"})
+	c.Check(err, gc.ErrorMatches, `subcommand "fooo" not found \(did you mean "foo"\?\)`)
+}
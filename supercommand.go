@@ -4,10 +4,11 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 	"io/ioutil"
-	"sort"
 	"strings"
+	"time"
 
 	"github.com/juju/errors"
 	"github.com/juju/loggo"
@@ -16,20 +17,48 @@ import (
 
 var logger = loggo.GetLogger("cmd")
 
+// text returns the full text of the topic when help is run in ctx.
+func (t topic) text(ctx *Context) string {
+	if t.describe != nil {
+		return t.describe(ctx)
+	}
+	return t.long()
+}
+
+// ShowHidden, if true, causes hidden subcommands and help topics to be
+// listed along with the others, so that developers can see them.
+var ShowHidden = false
+
 type topic struct {
 	short string
 	long  func() string
 	// Help aliases are not output when topics are listed, but are used
 	// to search for the help topic
 	alias bool
+	// Hidden topics are not listed unless ShowHidden is set, but are
+	// shown by "help <name>".
+	hidden bool
+	// describe, if not nil, is used in place of long for topics whose
+	// text depends on the Context that help is run in. Such topics are
+	// left out of generated documentation.
+	describe func(ctx *Context) string
+}
+
+// listed reports whether the topic is included when topics are listed.
+func (t topic) listed() bool {
+	return !t.hidden || ShowHidden
 }
 
 type UnrecognizedCommand struct {
 	Name string
+
+	// Suggestions holds the names of commands that Name may be a
+	// mistyping of.
+	Suggestions []string
 }
 
 func (e *UnrecognizedCommand) Error() string {
-	return fmt.Sprintf("unrecognized command: %s", e.Name)
+	return fmt.Sprintf("unrecognized command: %s", e.Name) + didYouMean(e.Suggestions)
 }
 
 // MissingCallback defines a function that will be used by the SuperCommand if
@@ -60,8 +89,86 @@ type SuperCommandParams struct {
 	// UserAliasesFilename refers to the location of a file that contains
 	//   name = cmd [args...]
 	// values, that is used to change default behaviour of commands in order
-	// to add flags, or provide short cuts to longer commands.
+	// to add flags, or provide short cuts to longer commands. When it is
+	// set, an "aliases" subcommand is registered that lists, adds and
+	// removes the aliases in the file.
 	UserAliasesFilename string
+
+	// Completion, if true, registers a "completion" subcommand that
+	// writes shell completion scripts for the command tree.
+	Completion bool
+
+	// TimeoutFlag, if true, adds a common --timeout flag. When it is
+	// set, the Context passed to the subcommand's Run is cancelled once
+	// the timeout has elapsed.
+	TimeoutFlag bool
+
+	// ErrorExitCodes maps errors returned by subcommands to the codes
+	// that Main exits with. The first matching entry is used; errors
+	// that implement ExitCoder keep their own code. Nested
+	// SuperCommands use these after their own.
+	ErrorExitCodes []ErrorExitCode
+
+	// ErrorFormatFlag, if true, adds a common --error-format flag. When
+	// it is set to json or yaml, errors are written to stderr as a
+	// document holding the message, the type of the error's cause, the
+	// exit code, the command name and the error's details.
+	ErrorFormatFlag bool
+
+	// ManPages, if true, adds a hidden "__manpages" subcommand that
+	// writes a man page for each command into the given directory.
+	ManPages bool
+
+	// FlagEnvPrefix, if set, allows the flags of the SuperCommand and
+	// its subcommands to be set from environment variables named by
+	// the prefix followed by the flag name in upper case, with hyphens
+	// replaced by underscores; for example, with a prefix of "JUJU_",
+	// $JUJU_MODEL sets --model. Flags given on the command line take
+	// precedence. Nested SuperCommands without a prefix of their own
+	// inherit this one when they are registered.
+	FlagEnvPrefix string
+
+	// ConfigFiles, if not nil, names configuration files that set
+	// default values for flags, and adds a common --config flag that
+	// names a file to use instead. Nested SuperCommands use the files
+	// of the SuperCommand they are registered with.
+	ConfigFiles *ConfigFiles
+
+	// FlagDeprecations marks the common flags of the SuperCommand
+	// that are being phased out, keyed by flag name.
+	FlagDeprecations map[string]FlagDeprecation
+
+	// Category names the group of commands that the SuperCommand is
+	// listed with when it is registered with another SuperCommand.
+	Category string
+
+	// PluginPrefix, if set, makes executables on the PATH whose names
+	// start with the prefix available as subcommands, unless a
+	// MissingCallback is given, and adds a "plugins" help topic that
+	// lists them. See FindPlugins.
+	PluginPrefix string
+
+	// PluginCacheFile, if set, names a file in which the descriptions
+	// of plugins are cached, so that unchanged plugins need not be run
+	// each time they are listed.
+	PluginCacheFile string
+
+	// PluginTimeout holds how long each plugin is given to describe
+	// itself when plugins are listed. It defaults to
+	// DefaultPluginTimeout.
+	PluginTimeout time.Duration
+
+	// Categories sets the order in which the groups of subcommands
+	// named by their Info.Category are listed, and their headers.
+	// Groups that are not described here follow in alphabetical order,
+	// and subcommands without a category are listed last.
+	Categories []Category
+
+	// Middleware wraps the Run of every subcommand that is selected,
+	// including those of nested SuperCommands, which run within the
+	// middleware of the SuperCommands above them. The first Middleware
+	// is the outermost.
+	Middleware []Middleware
 }
 
 // NewSuperCommand creates and initializes a new `SuperCommand`, and returns
@@ -78,6 +185,25 @@ func NewSuperCommand(params SuperCommandParams) *SuperCommand {
 		version:             params.Version,
 		notifyRun:           params.NotifyRun,
 		userAliasesFilename: params.UserAliasesFilename,
+		completion:          params.Completion,
+		timeoutFlag:         params.TimeoutFlag,
+		errorExitCodes:      params.ErrorExitCodes,
+		manPages:            params.ManPages,
+		flagEnvPrefix:       params.FlagEnvPrefix,
+		configFiles:         params.ConfigFiles,
+		flagDeprecations:    params.FlagDeprecations,
+		category:            params.Category,
+		categories:          params.Categories,
+		pluginPrefix:        params.PluginPrefix,
+		pluginCacheFile:     params.PluginCacheFile,
+		pluginTimeout:       params.PluginTimeout,
+		middleware:          params.Middleware,
+	}
+	if command.missingCallback == nil && params.PluginPrefix != "" {
+		command.missingCallback = PluginMissingCallback(params.PluginPrefix)
+	}
+	if params.ErrorFormatFlag {
+		command.errorFormat = newFormatterValue("text", errorFormatters)
 	}
 	command.init()
 	return command
@@ -102,6 +228,7 @@ type commandReference struct {
 	command Command
 	alias   string
 	check   DeprecationCheck
+	hidden  bool
 }
 
 // SuperCommand is a Command that selects a subcommand and assumes its
@@ -118,7 +245,7 @@ type SuperCommand struct {
 	version             string
 	usagePrefix         string
 	userAliasesFilename string
-	userAliases         map[string][]string
+	userAliases         map[string]Alias
 	subcmds             map[string]commandReference
 	help                *helpCommand
 	commonflags         *gnuflag.FlagSet
@@ -128,8 +255,44 @@ type SuperCommand struct {
 	showDescription     bool
 	showVersion         bool
 	noAlias             bool
-	missingCallback     MissingCallback
-	notifyRun           func(string)
+	aliasExpansion      []string
+	completion          bool
+	timeoutFlag         bool
+	timeout             time.Duration
+	errorExitCodes      []ErrorExitCode
+	// parentErrorExitCodes holds the ErrorExitCodes inherited from the
+	// SuperCommands above this one when it is run.
+	parentErrorExitCodes []ErrorExitCode
+	errorFormat          *formatterValue
+	manPages             bool
+	flagEnvPrefix        string
+	configFiles          *ConfigFiles
+	configOverride       string
+	flagDeprecations     map[string]FlagDeprecation
+	flagWarnings         []string
+	category             string
+	categories           []Category
+	pluginPrefix         string
+	pluginCacheFile      string
+	pluginTimeout        time.Duration
+	plugins              []Plugin
+	pluginDetails        map[string]pluginInfo
+	middleware           []Middleware
+	parentMiddleware     []Middleware
+	actionArgs           []string
+	missingCallback      MissingCallback
+	notifyRun            func(string)
+
+	// initContext holds the Context that Main will run the command
+	// in, as given to setContext, so that Init can set flags from the
+	// environment and plugins can be found before Run is called.
+	initContext *Context
+
+	// config holds the flag values read from the configuration files,
+	// once Init has loaded them, and configPath holds the names of
+	// the commands between the root SuperCommand and this one.
+	config     *flagConfig
+	configPath []string
 }
 
 // IsSuperCommand implements Command.IsSuperCommand
@@ -137,6 +300,17 @@ func (c *SuperCommand) IsSuperCommand() bool {
 	return true
 }
 
+// setContext implements contextCommand. The SuperCommands registered
+// beneath c are given ctx too, since any of them may be selected by Init.
+func (c *SuperCommand) setContext(ctx *Context) {
+	c.initContext = ctx
+	for _, action := range c.subcmds {
+		if super, ok := action.command.(*SuperCommand); ok {
+			super.setContext(ctx)
+		}
+	}
+}
+
 func (c *SuperCommand) init() {
 	if c.subcmds != nil {
 		return
@@ -146,15 +320,33 @@ func (c *SuperCommand) init() {
 	}
 	c.help.init()
 	c.subcmds = map[string]commandReference{
-		"help": commandReference{command: c.help},
+		"help": commandReference{name: "help", command: c.help},
 	}
 	if c.version != "" {
 		c.subcmds["version"] = commandReference{
+			name:    "version",
 			command: newVersionCommand(c.version),
 		}
 	}
+	if c.completion {
+		c.subcmds["completion"] = commandReference{
+			name:    "completion",
+			command: &completionCommand{super: c},
+		}
+	}
 
-	c.userAliases = ParseAliasFile(c.userAliasesFilename)
+	if c.userAliasesFilename != "" {
+		c.subcmds[aliasesCommandName] = commandReference{
+			name:    aliasesCommandName,
+			command: newAliasesCommand(c),
+		}
+	}
+
+	aliases, errs := readAliasFile(c.userAliasesFilename)
+	for _, err := range errs {
+		logger.Warningf("%v", err)
+	}
+	c.userAliases = aliases
 }
 
 // AddHelpTopic adds a new help topic with the description being the short
@@ -162,13 +354,20 @@ func (c *SuperCommand) init() {
 // 'help topics', and the full text is shown when the command 'help <name>' is
 // called.
 func (c *SuperCommand) AddHelpTopic(name, short, long string, aliases ...string) {
-	c.help.addTopic(name, short, echo(long), aliases...)
+	c.help.addTopic(name, short, echo(long), false, aliases...)
+}
+
+// AddHiddenHelpTopic adds a help topic in the same way as AddHelpTopic,
+// except that the topic is not listed by 'help topics' or included in
+// documentation unless ShowHidden is set.
+func (c *SuperCommand) AddHiddenHelpTopic(name, short, long string, aliases ...string) {
+	c.help.addTopic(name, short, echo(long), true, aliases...)
 }
 
 // AddHelpTopicCallback adds a new help topic with the description being the
 // short param, and the full text being defined by the callback function.
 func (c *SuperCommand) AddHelpTopicCallback(name, short string, longCallback func() string) {
-	c.help.addTopic(name, short, longCallback)
+	c.help.addTopic(name, short, longCallback, false)
 }
 
 // Register makes a subcommand available for use on the command line. The
@@ -181,6 +380,18 @@ func (c *SuperCommand) Register(subcmd Command) {
 	}
 }
 
+// RegisterHidden makes a subcommand available for use on the command line
+// without listing it in help output, documentation or shell completions,
+// unless ShowHidden is set. The command and its aliases still run, and
+// "help <name>" still describes it.
+func (c *SuperCommand) RegisterHidden(subcmd Command) {
+	info := subcmd.Info()
+	c.insert(commandReference{name: info.Name, command: subcmd, hidden: true})
+	for _, name := range info.Aliases {
+		c.insert(commandReference{name: name, command: subcmd, alias: info.Name, hidden: true})
+	}
+}
+
 // RegisterDeprecated makes a subcommand available for use on the command line if it
 // is not obsolete.  It inserts the command with the specified DeprecationCheck so
 // that a warning is displayed if the command is deprecated.
@@ -217,6 +428,7 @@ func (c *SuperCommand) RegisterAlias(name, forName string, check DeprecationChec
 		command: action.command,
 		alias:   forName,
 		check:   check,
+		hidden:  action.hidden,
 	})
 }
 
@@ -248,6 +460,7 @@ func (c *SuperCommand) RegisterSuperAlias(name, super, forName string, check Dep
 		command: action.command,
 		alias:   super + " " + forName,
 		check:   check,
+		hidden:  action.hidden,
 	})
 }
 
@@ -255,42 +468,40 @@ func (c *SuperCommand) insert(value commandReference) {
 	if _, found := c.subcmds[value.name]; found {
 		panic(fmt.Sprintf("command already registered: %q", value.name))
 	}
+	if super, ok := value.command.(*SuperCommand); ok && super.flagEnvPrefix == "" {
+		super.flagEnvPrefix = c.flagEnvPrefix
+	}
 	c.subcmds[value.name] = value
 }
 
-// describeCommands returns a short description of each registered subcommand.
-func (c *SuperCommand) describeCommands(simple bool) string {
+// describeCommands returns a short description of each registered
+// subcommand, and of each plugin if withPlugins is true. If any of them
+// have a category, the subcommands are listed in a section for each
+// category.
+func (c *SuperCommand) describeCommands(simple, withPlugins bool) string {
 	var lineFormat = "    %-*s - %s"
 	var outputFormat = "commands:\n%s"
 	if simple {
 		lineFormat = "%-*s  %s"
 		outputFormat = "%s"
 	}
-	cmds := make([]string, len(c.subcmds))
-	i := 0
-	longest := 0
-	for name := range c.subcmds {
-		if len(name) > longest {
-			longest = len(name)
-		}
-		cmds[i] = name
-		i++
-	}
-	sort.Strings(cmds)
-	var result []string
-	for _, name := range cmds {
-		action := c.subcmds[name]
-		if deprecated, _ := action.Deprecated(); deprecated {
-			continue
+	entries, longest := c.commandEntries(withPlugins)
+	describe := func(entries []commandEntry) string {
+		var result []string
+		for _, entry := range entries {
+			result = append(result, fmt.Sprintf(lineFormat, longest, entry.name, entry.purpose))
 		}
-		info := action.command.Info()
-		purpose := info.Purpose
-		if action.alias != "" {
-			purpose = "alias for '" + action.alias + "'"
-		}
-		result = append(result, fmt.Sprintf(lineFormat, longest, name, purpose))
+		return strings.Join(result, "\n")
+	}
+	groups := c.groupCommands(entries)
+	if len(groups) == 0 || len(groups) == 1 && groups[0].category == "" {
+		return fmt.Sprintf(outputFormat, describe(entries))
+	}
+	var sections []string
+	for _, group := range groups {
+		sections = append(sections, group.title+":\n"+describe(group.entries))
 	}
-	return fmt.Sprintf(outputFormat, strings.Join(result, "\n"))
+	return strings.Join(sections, "\n\n")
 }
 
 // Info returns a description of the currently selected subcommand, or of the
@@ -301,20 +512,29 @@ func (c *SuperCommand) Info() *Info {
 		info.Name = fmt.Sprintf("%s %s", c.Name, info.Name)
 		return &info
 	}
+	return &Info{
+		Name:             c.Name,
+		Args:             "<command> ...",
+		Purpose:          c.Purpose,
+		Doc:              c.doc(false),
+		Aliases:          c.Aliases,
+		Category:         c.category,
+		FlagDeprecations: c.flagDeprecations,
+	}
+}
+
+// doc returns the Doc of c's own Info, followed by a description of its
+// subcommands. Plugins are only listed if withPlugins is true, since
+// they must be run to describe themselves; that is left to help.
+func (c *SuperCommand) doc(withPlugins bool) string {
 	docParts := []string{}
 	if doc := strings.TrimSpace(c.Doc); doc != "" {
 		docParts = append(docParts, doc)
 	}
-	if cmds := c.describeCommands(false); cmds != "" {
+	if cmds := c.describeCommands(false, withPlugins); cmds != "" {
 		docParts = append(docParts, cmds)
 	}
-	return &Info{
-		Name:    c.Name,
-		Args:    "<command> ...",
-		Purpose: c.Purpose,
-		Doc:     strings.Join(docParts, "\n\n"),
-		Aliases: c.Aliases,
-	}
+	return strings.Join(docParts, "\n\n")
 }
 
 const helpPurpose = "show help on a command or other topic"
@@ -333,6 +553,15 @@ func (c *SuperCommand) SetCommonFlags(f *gnuflag.FlagSet) {
 	// The Purpose attribute will be printed (if defined), allowing
 	// plugins to provide a sensible line of text for 'juju help plugins'.
 	f.BoolVar(&c.showDescription, "description", false, "")
+	if c.timeoutFlag {
+		f.DurationVar(&c.timeout, "timeout", 0, "stop the command if it runs for longer than this (e.g. 30s, 5m)")
+	}
+	if c.errorFormat != nil {
+		f.Var(c.errorFormat, "error-format", "Specify error output format (json|text|yaml)")
+	}
+	if c.configFiles != nil {
+		f.StringVar(&c.configOverride, configFlagName, "", "Specify a configuration file to read option defaults from, instead of the usual files")
+	}
 	c.commonflags = gnuflag.NewFlagSet(c.Info().Name, gnuflag.ContinueOnError)
 	c.commonflags.SetOutput(ioutil.Discard)
 	f.VisitAll(func(flag *gnuflag.Flag) {
@@ -356,6 +585,30 @@ func (c *SuperCommand) SetFlags(f *gnuflag.FlagSet) {
 	c.flags = f
 }
 
+// inspectFlags returns a FlagSet holding the flags that SetFlags, or
+// SetCommonFlags if common is true, would add. The flags are bound to a
+// copy of c, so that c's own values, which may have been parsed from
+// the command line already, are left alone.
+func (c *SuperCommand) inspectFlags(common bool) *gnuflag.FlagSet {
+	scratch := *c
+	if c.Log != nil {
+		log := *c.Log
+		scratch.Log = &log
+	}
+	if c.errorFormat != nil {
+		errorFormat := *c.errorFormat
+		scratch.errorFormat = &errorFormat
+	}
+	f := gnuflag.NewFlagSet(c.Name, gnuflag.ContinueOnError)
+	f.SetOutput(ioutil.Discard)
+	if common {
+		scratch.SetCommonFlags(f)
+	} else {
+		scratch.SetFlags(f)
+	}
+	return f
+}
+
 // For a SuperCommand, we want to parse the args with
 // allowIntersperse=false. This will mean that the args may contain other
 // options that haven't been defined yet, and that only options that relate
@@ -371,29 +624,50 @@ func (c *SuperCommand) Init(args []string) error {
 	}
 	if len(args) == 0 {
 		c.action = c.subcmds["help"]
-		return c.action.command.Init(args)
+		return c.initAction(args)
 	}
 
-	if userAlias, found := c.userAliases[args[0]]; found && !c.noAlias {
-		logger.Debugf("using alias %q=%q", args[0], strings.Join(userAlias, " "))
-		args = append(userAlias, args[1:]...)
+	if hidden := c.hiddenCommand(args[0]); hidden != nil {
+		// Hidden entry points are not registered with the other
+		// subcommands, and their args are not parsed.
+		c.action = commandReference{
+			name:    args[0],
+			command: hidden,
+		}
+		return c.initAction(args[1:])
+	}
+
+	if !c.noAlias {
+		expanded, err := c.expandAliases(args)
+		if err != nil {
+			return err
+		}
+		args = expanded
 	}
 	found := false
 	// Look for the command.
 	if c.action, found = c.subcmds[args[0]]; !found {
+		name := args[0]
+		suggestions := func() []string {
+			return suggest(name, c.commandNames())
+		}
 		if c.missingCallback != nil {
 			c.action = commandReference{
+				name: args[0],
 				command: &missingCommand{
-					callback:  c.missingCallback,
-					superName: c.Name,
-					name:      args[0],
-					args:      args[1:],
+					callback:    c.missingCallback,
+					superName:   c.Name,
+					commandPath: c.prefixedName(c.Name),
+					name:        args[0],
+					args:        args[1:],
+					suggestions: suggestions,
 				},
 			}
 			// Yes return here, no Init called on missing Command.
+			c.actionArgs = args[1:]
 			return nil
 		}
-		return fmt.Errorf("unrecognized command: %s %s", c.Name, args[0])
+		return &UnrecognizedCommand{Name: c.Name + " " + args[0], Suggestions: suggestions()}
 	}
 	args = args[1:]
 	subcmd := c.action.command
@@ -404,25 +678,178 @@ func (c *SuperCommand) Init(args []string) error {
 	} else {
 		subcmd.SetFlags(c.commonflags)
 	}
+	deprecations := c.subcommandFlagDeprecations(subcmd)
 	if err := c.commonflags.Parse(subcmd.AllowInterspersedFlags(), args); err != nil {
+		return suggestFlag(c.commonflags, deprecations, err)
+	}
+	// Flags given before the subcommand were parsed into c.flags.
+	warnings, err := checkFlagDeprecations(deprecations, c.flags, c.commonflags)
+	if err != nil {
+		return err
+	}
+	c.flagWarnings = warnings
+	if err := c.setUnsetFlags(subcmd); err != nil {
+		return err
+	}
+	if err := checkParsedFlags(c.flags, c.commonflags); err != nil {
 		return err
 	}
 	args = c.commonflags.Args()
+	if super, ok := subcmd.(*SuperCommand); ok && c.noAlias {
+		super.noAlias = true
+	}
 	if c.showHelp {
 		// We want to treat help for the command the same way we would if we went "help foo".
 		args = []string{c.action.name}
 		c.action = c.subcmds["help"]
 	}
+	return c.initAction(args)
+}
+
+// initAction initializes the selected subcommand with args, which are
+// recorded for any Middleware that runs it.
+func (c *SuperCommand) initAction(args []string) error {
+	c.actionArgs = args
 	return c.action.command.Init(args)
 }
 
+// expandAliases returns args with the user alias named by args[0]
+// expanded, along with any aliases that the expansion starts with in
+// turn. An alias whose expansion starts with its own name runs the
+// command of that name. Aliases of nested SuperCommands are expanded
+// when they are initialized.
+func (c *SuperCommand) expandAliases(args []string) ([]string, error) {
+	var expanded []string
+	for {
+		name := args[0]
+		userAlias, found := c.userAliases[name]
+		if !found {
+			break
+		}
+		for _, previous := range expanded {
+			if previous == name {
+				return nil, fmt.Errorf("alias loop detected: %s", strings.Join(append(expanded, name), " -> "))
+			}
+		}
+		expanded = append(expanded, name)
+		logger.Debugf("using alias %q=%q", name, strings.Join(userAlias.Args, " "))
+		var err error
+		if args, err = userAlias.expand(args[1:]); err != nil {
+			return nil, err
+		}
+		if args[0] == name {
+			break
+		}
+	}
+	if expanded != nil {
+		c.aliasExpansion = args
+	}
+	return args, nil
+}
+
+// aliasTarget returns the name of the command that the named user alias
+// runs, following any aliases that it refers to. Any other name is
+// returned unchanged.
+func (c *SuperCommand) aliasTarget(name string) string {
+	seen := make(map[string]bool)
+	for {
+		userAlias, found := c.userAliases[name]
+		if !found || seen[name] {
+			return name
+		}
+		seen[name] = true
+		name = userAlias.Args[0]
+	}
+}
+
+// setUnsetFlags sets the common flags, and those of subcmd, that were
+// not given on the command line from the environment variables bound to
+// them, or failing that from the configuration files. A nested
+// SuperCommand sets its own flags when it is initialized.
+func (c *SuperCommand) setUnsetFlags(subcmd Command) error {
+	if c.initContext == nil {
+		return nil
+	}
+	var explicit map[string]string
+	if !subcmd.IsSuperCommand() {
+		explicit = subcmd.Info().FlagEnv
+	}
+	given := givenFlags(c.flags, c.commonflags)
+	bindings := flagEnvBindings(c.commonflags, explicit, c.flagEnvPrefix)
+	if err := setFlagsFromEnv(c.initContext, c.commonflags, bindings, given); err != nil {
+		return err
+	}
+	// The environment may choose the configuration file.
+	if c.config == nil && c.configFiles != nil {
+		config, err := loadFlagConfig(c.initContext, *c.configFiles, c.configOverride)
+		if err != nil {
+			return err
+		}
+		c.config = config
+	}
+	path := append(c.configPath[:len(c.configPath):len(c.configPath)], subcmd.Info().Name)
+	if super, ok := subcmd.(*SuperCommand); ok {
+		super.config = c.config
+		super.configPath = path
+	}
+	if c.config == nil {
+		return nil
+	}
+	return c.config.setFlags(c.commonflags, path, given)
+}
+
+// subcommandFlagDeprecations returns the deprecations of the flags that
+// c parses for subcmd: its common flags and, unless subcmd is a
+// SuperCommand, the flags of subcmd.
+func (c *SuperCommand) subcommandFlagDeprecations(subcmd Command) map[string]FlagDeprecation {
+	if subcmd.IsSuperCommand() {
+		return c.flagDeprecations
+	}
+	return mergeFlagDeprecations(c.flagDeprecations, subcmd.Info().FlagDeprecations)
+}
+
+// commandNames returns the names that select a subcommand of c, other
+// than those of deprecated and unlisted hidden commands, along with the
+// names of the user aliases and plugins.
+func (c *SuperCommand) commandNames() []string {
+	var names []string
+	for name, action := range c.subcmds {
+		if deprecated, _ := action.Deprecated(); !deprecated && action.listed() {
+			names = append(names, name)
+		}
+	}
+	if !c.noAlias {
+		for name := range c.userAliases {
+			if _, found := c.subcmds[name]; !found {
+				names = append(names, name)
+			}
+		}
+	}
+	for _, plugin := range c.findPlugins() {
+		names = append(names, plugin.Name)
+	}
+	return names
+}
+
+// hiddenCommand returns the enabled hidden subcommand with the given
+// name, or nil if there is none.
+func (c *SuperCommand) hiddenCommand(name string) Command {
+	switch {
+	case name == completeCommandName && c.completion:
+		return &completeCommand{super: c}
+	case name == manPagesCommandName && c.manPages:
+		return &manPagesCommand{super: c}
+	}
+	return nil
+}
+
 // Run executes the subcommand that was selected in Init.
 func (c *SuperCommand) Run(ctx *Context) error {
 	if c.showDescription {
 		if c.Purpose != "" {
 			fmt.Fprintf(ctx.Stdout, "%s\n", c.Purpose)
 		} else {
-			fmt.Fprintf(ctx.Stdout, "%s: no description available\n", c.Info().Name)
+			fmt.Fprintf(ctx.Stdout, "%s: no description available\n", c.Name)
 		}
 		return nil
 	}
@@ -434,23 +861,52 @@ func (c *SuperCommand) Run(ctx *Context) error {
 			return err
 		}
 	}
+	if c.aliasExpansion != nil {
+		logger.Debugf("expanded command line: %s %q", c.prefixedName(c.Name), c.aliasExpansion)
+	}
 	if c.notifyRun != nil {
-		name := c.Name
-		if c.usagePrefix != "" && c.usagePrefix != name {
-			name = c.usagePrefix + " " + name
-		}
-		c.notifyRun(name)
+		c.notifyRun(c.prefixedName(c.Name))
 	}
 	if deprecated, replacement := c.action.Deprecated(); deprecated {
 		ctx.Infof("WARNING: %q is deprecated, please use %q", c.action.name, replacement)
 	}
-	err := c.action.command.Run(ctx)
+	for _, warning := range c.flagWarnings {
+		ctx.Infof("WARNING: %s", warning)
+	}
+	if c.timeout > 0 {
+		parent := ctx.stdctx
+		stdctx, cancel := context.WithTimeout(ctx.context(), c.timeout)
+		ctx.stdctx = stdctx
+		defer func() {
+			cancel()
+			ctx.stdctx = parent
+		}()
+	}
+	var err error
+	if sub, ok := c.action.command.(*SuperCommand); ok {
+		if c.structuredErrors() && !sub.structuredErrors() {
+			sub.errorFormat = c.errorFormat
+		}
+		// The nested SuperCommand runs its selected subcommand within
+		// this SuperCommand's middleware.
+		sub.parentMiddleware = c.middlewareChain()
+		sub.parentErrorExitCodes = c.errorExitCodeChain()
+		err = sub.Run(ctx)
+	} else {
+		err = runMiddleware(ctx, c.middlewareChain(), RunInfo{
+			Path:    c.prefixedName(c.Name + " " + c.action.name),
+			Command: c.action.command,
+			Args:    c.actionArgs,
+		})
+	}
 	if err != nil && !IsErrSilent(err) {
-		logger.Errorf("%v", err)
+		if !c.structuredErrors() || !c.writeErrorDocument(ctx, c.prefixedName(c.Info().Name), err, c.runExitCode(ctx, err)) {
+			logger.Errorf("%v", err)
+		}
 		logger.Debugf("(error details: %v)", errors.Details(err))
 		// Now that this has been logged, don't log again in cmd.Main.
 		if !IsRcPassthroughError(err) {
-			err = ErrSilent
+			err = c.silence(err)
 		}
 	} else {
 		logger.Infof("command finished")
@@ -458,27 +914,73 @@ func (c *SuperCommand) Run(ctx *Context) error {
 	return err
 }
 
+// prefixedName returns name prefixed by c's UsagePrefix, unless the
+// prefix is c's own name.
+func (c *SuperCommand) prefixedName(name string) string {
+	if c.usagePrefix != "" && c.usagePrefix != c.Name {
+		name = c.usagePrefix + " " + name
+	}
+	return name
+}
+
+// runExitCode returns the code that Main will exit with when err is
+// returned by the selected subcommand.
+func (c *SuperCommand) runExitCode(ctx *Context, err error) int {
+	if code, ok := c.exitCode(err); ok {
+		return code
+	}
+	if ctx.Err() == context.Canceled {
+		// Only an interrupt cancels the context while Run is in progress.
+		return ExitInterrupted
+	}
+	return ExitFailure
+}
+
+// silence returns the error to report in place of err once it has been
+// logged, keeping the exit code that err maps to.
+func (c *SuperCommand) silence(err error) error {
+	if code, ok := c.exitCode(err); ok && code != ExitFailure {
+		return &silentError{code}
+	}
+	return ErrSilent
+}
+
 type missingCommand struct {
 	CommandBase
-	callback  MissingCallback
-	superName string
-	name      string
-	args      []string
+	callback    MissingCallback
+	superName   string
+	commandPath string
+	name        string
+	args        []string
+	// suggestions, if set, returns the commands to suggest when the
+	// callback does not recognize the command. Finding them may mean
+	// looking for plugins, so it is only done when needed.
+	suggestions func() []string
 }
 
-// Missing commands only need to supply Info for the interface, but this is
-// never called.
+// Info returns the name of the missing command, which is all that is known
+// of it; the name is used when reporting errors from the command.
 func (c *missingCommand) Info() *Info {
-	return nil
+	return &Info{Name: c.name}
 }
 
 func (c *missingCommand) Run(ctx *Context) error {
-	err := c.callback(ctx, c.name, c.args)
+	err := c.callback(pluginContext(ctx, c.commandPath), c.name, c.args)
 	_, isUnrecognized := err.(*UnrecognizedCommand)
 	if !isUnrecognized {
 		return err
 	}
-	return &UnrecognizedCommand{c.superName + " " + c.name}
+	var suggestions []string
+	if c.suggestions != nil {
+		suggestions = c.suggestions()
+	}
+	return &UnrecognizedCommand{Name: c.superName + " " + c.name, Suggestions: suggestions}
+}
+
+// listed reports whether the command is included when subcommands are
+// listed.
+func (r commandReference) listed() bool {
+	return !r.hidden || ShowHidden
 }
 
 // Deprecated calls into the check interface if one was specified,
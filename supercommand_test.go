@@ -5,6 +5,7 @@ package cmd_test
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io/ioutil"
 	"path/filepath"
@@ -117,6 +118,118 @@ func (s *SuperCommandSuite) TestUserAliasDispatch(c *gc.C) {
 	c.Assert(err, gc.ErrorMatches, "unrecognized command: jujutest missing")
 }
 
+func (s *SuperCommandSuite) TestUserAliasesVersion2(c *gc.C) {
+	filename := filepath.Join(c.MkDir(), "aliases")
+	err := ioutil.WriteFile(filename, []byte(`# alias-format: 2
+# Defenestrate firmly.
+firm = defenestrate --option "firmly and $1"
+echo = defenestrate --option $@
+plain = defenestrate --option
+`), 0644)
+	c.Assert(err, gc.IsNil)
+	for i, t := range []struct {
+		args   []string
+		option string
+		err    string
+	}{{
+		args:   []string{"firm", "quickly"},
+		option: "firmly and quickly",
+	}, {
+		args: []string{"firm"},
+		err:  `alias "firm" needs at least 1 argument\(s\), got 0`,
+	}, {
+		args:   []string{"echo", "a b"},
+		option: "a b",
+	}, {
+		args:   []string{"plain", "appended"},
+		option: "appended",
+	}} {
+		c.Logf("test %d: %q", i, t.args)
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest", UserAliasesFilename: filename})
+		tc := &TestCommand{Name: "defenestrate"}
+		jc.Register(tc)
+		err := cmdtesting.InitCommand(jc, t.args)
+		if t.err != "" {
+			c.Check(err, gc.ErrorMatches, t.err)
+			continue
+		}
+		c.Check(err, gc.IsNil)
+		c.Check(tc.Option, gc.Equals, t.option)
+	}
+
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest", UserAliasesFilename: filename})
+	jc.Register(&TestCommand{Name: "defenestrate"})
+	c.Assert(jc.Info().Doc, gc.Equals, `commands:
+    aliases      - manage command aliases
+    defenestrate - defenestrate the juju
+    firm         - Defenestrate firmly.
+    help         - show help on a command or other topic`)
+}
+
+func (s *SuperCommandSuite) TestUserAliasesRecursive(c *gc.C) {
+	dir := c.MkDir()
+	filename := filepath.Join(dir, "aliases")
+	err := ioutil.WriteFile(filename, []byte(`
+firm = defenestrate --option firmly
+f = firm
+loop1 = loop2
+loop2 = loop3
+loop3 = loop1
+bl = bar hl
+`), 0644)
+	c.Assert(err, gc.IsNil)
+	barFilename := filepath.Join(dir, "bar-aliases")
+	err = ioutil.WriteFile(barFilename, []byte(`
+foo = foo --option self
+hl = foo --option nested
+`), 0644)
+	c.Assert(err, gc.IsNil)
+	newSuper := func() *cmd.SuperCommand {
+		jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest", UserAliasesFilename: filename})
+		jc.Register(&TestCommand{Name: "defenestrate"})
+		bar := cmd.NewSuperCommand(cmd.SuperCommandParams{
+			Name:                "bar",
+			UsagePrefix:         "jujutest",
+			UserAliasesFilename: barFilename,
+		})
+		bar.Register(&TestCommand{Name: "foo"})
+		jc.Register(bar)
+		return jc
+	}
+	for i, t := range []struct {
+		args   []string
+		output string
+		err    string
+	}{{
+		args:   []string{"f"},
+		output: "firmly\n",
+	}, {
+		args: []string{"loop2"},
+		err:  "alias loop detected: loop2 -> loop3 -> loop1 -> loop2",
+	}, {
+		args:   []string{"bar", "foo"},
+		output: "self\n",
+	}, {
+		args:   []string{"bl"},
+		output: "nested\n",
+	}, {
+		args: []string{"--no-alias", "bar", "hl"},
+		err:  "unrecognized command: bar hl",
+	}} {
+		c.Logf("test %d: %q", i, t.args)
+		ctx, err := cmdtesting.RunCommand(c, newSuper(), t.args...)
+		if t.err != "" {
+			c.Check(err, gc.ErrorMatches, t.err)
+			continue
+		}
+		c.Check(err, gc.IsNil)
+		c.Check(cmdtesting.Stdout(ctx), gc.Equals, t.output)
+	}
+	log := c.GetTestLog()
+	c.Check(strings.Contains(log, `expanded command line: jujutest ["bar" "hl"]`), gc.Equals, true)
+	c.Check(strings.Contains(log, `expanded command line: jujutest bar ["foo" "--option" "self" "--option" "nested"]`), gc.Equals, true)
+}
+
 func (s *SuperCommandSuite) TestRegister(c *gc.C) {
 	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
 	jc.Register(&TestCommand{Name: "flip"})
@@ -236,15 +349,15 @@ func (s *SuperCommandSuite) TestVersionNotProvided(c *gc.C) {
 	}
 
 	// juju version
-	baselineCode := cmd.Main(jc, ctx, []string{"version"})
-	c.Check(baselineCode, gc.Not(gc.Equals), 0)
+	code := cmd.Main(jc, ctx, []string{"version"})
+	c.Check(code, gc.Equals, cmd.ExitUnknownCommand)
 	c.Assert(stderr.String(), gc.Equals, "error: unrecognized command: jujutest version\n")
 	stderr.Reset()
 	stdout.Reset()
 
 	// juju --version
-	code := cmd.Main(jc, ctx, []string{"--version"})
-	c.Check(code, gc.Equals, baselineCode)
+	code = cmd.Main(jc, ctx, []string{"--version"})
+	c.Check(code, gc.Equals, cmd.ExitUsage)
 	c.Assert(stderr.String(), gc.Equals, "error: flag provided but not defined: --version\n")
 }
 
@@ -452,7 +565,7 @@ func (s *SuperCommandSuite) TestRegisterAlias(c *gc.C) {
 		}, {
 			name:   "baz",
 			stderr: "error: unrecognized command: jujutest baz\n",
-			code:   2,
+			code:   cmd.ExitUnknownCommand,
 		},
 	} {
 		ctx := cmdtesting.Context(c)
@@ -515,9 +628,10 @@ func (s *SuperCommandSuite) TestRegisterSuperAlias(c *gc.C) {
 			stdout: "foo arg\n",
 			stderr: "WARNING: \"bar-dep\" is deprecated, please use \"bar foo\"\n",
 		}, {
+			// The deprecated bar-dep is not suggested.
 			args:   []string{"bar-ob", "arg"},
-			stderr: "error: unrecognized command: jujutest bar-ob\n",
-			code:   2,
+			stderr: "error: unrecognized command: jujutest bar-ob (did you mean \"bar-foo\"?)\n",
+			code:   cmd.ExitUnknownCommand,
 		},
 	} {
 		ctx := cmdtesting.Context(c)
@@ -577,11 +691,11 @@ func (s *SuperCommandSuite) TestRegisterDeprecated(c *gc.C) {
 		}, {
 			args:   []string{"test-ob", "arg"},
 			stderr: "error: unrecognized command: jujutest test-ob\n",
-			code:   2,
+			code:   cmd.ExitUnknownCommand,
 		}, {
 			args:   []string{"test-ob-alias", "arg"},
 			stderr: "error: unrecognized command: jujutest test-ob-alias\n",
-			code:   2,
+			code:   cmd.ExitUnknownCommand,
 		},
 	} {
 
@@ -592,3 +706,24 @@ func (s *SuperCommandSuite) TestRegisterDeprecated(c *gc.C) {
 		c.Check(cmdtesting.Stdout(ctx), gc.Equals, test.stdout)
 	}
 }
+
+func (s *SuperCommandSuite) TestTimeoutFlag(c *gc.C) {
+	jc := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:        "jujutest",
+		TimeoutFlag: true,
+	})
+	command := &waitCommand{}
+	jc.Register(command)
+	ctx := cmdtesting.Context(c)
+	code := cmd.Main(jc, ctx, []string{"wait", "--timeout", "10ms"})
+	c.Check(code, gc.Equals, 1)
+	c.Check(command.err, gc.Equals, context.DeadlineExceeded)
+	c.Check(ctx.Err(), gc.IsNil)
+
+	jc = cmd.NewSuperCommand(cmd.SuperCommandParams{Name: "jujutest"})
+	jc.Register(&waitCommand{})
+	ctx = cmdtesting.Context(c)
+	code = cmd.Main(jc, ctx, []string{"wait", "--timeout", "10ms"})
+	c.Check(code, gc.Equals, 2)
+	c.Check(cmdtesting.Stderr(ctx), gc.Equals, "error: flag provided but not defined: --timeout\n")
+}
@@ -0,0 +1,240 @@
+// Copyright 2016 Canonical Ltd.
+// Licensed under the LGPLv3, see LICENSE file for details.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// FormatTabular marshals value into aligned columns, one row per element
+// when value is a slice or array of structs or maps, or a single row
+// when value is a struct or map. The columns of a struct are its
+// exported fields, headed by the name in their "tabular", "yaml" or
+// "json" tag, in that order of preference; a tag of "-" omits the
+// field. The columns of a map are its keys, in sorted order. Any other
+// value is delegated to FormatSmart.
+func FormatTabular(value interface{}) ([]byte, error) {
+	return formatTabular(value, nil, true)
+}
+
+// formatTabular formats value as FormatTabular does. If columns is not
+// empty, only the named columns are written, in the order given; names
+// match headers regardless of case. The header row is omitted unless
+// headers is true.
+func formatTabular(value interface{}, columns []string, headers bool) ([]byte, error) {
+	if value == nil {
+		return nil, nil
+	}
+	table, ok := tabulate(reflect.ValueOf(value))
+	if !ok {
+		if len(columns) > 0 {
+			return nil, fmt.Errorf("cannot select columns from %T", value)
+		}
+		return FormatSmart(value)
+	}
+	if len(columns) > 0 {
+		var err error
+		if table, err = table.selectColumns(columns); err != nil {
+			return nil, err
+		}
+	}
+	buf := &bytes.Buffer{}
+	tw := tabwriter.NewWriter(buf, 0, 1, 2, ' ', 0)
+	if headers {
+		fmt.Fprintln(tw, strings.Join(table.headers, "\t"))
+	}
+	for _, row := range table.rows {
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	if err := tw.Flush(); err != nil {
+		return nil, err
+	}
+	// Empty cells at the end of a row leave padding behind.
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " ")
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
+
+// table holds the cells of a value formatted by FormatTabular.
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+// tabulate returns the table for v, and whether v can be represented
+// as a table.
+func tabulate(v reflect.Value) (*table, bool) {
+	v = indirect(v)
+	switch v.Kind() {
+	case reflect.Struct, reflect.Map:
+		return tabulateRows([]reflect.Value{v}, v.Type())
+	case reflect.Slice, reflect.Array:
+		elemType := v.Type().Elem()
+		for elemType.Kind() == reflect.Ptr {
+			elemType = elemType.Elem()
+		}
+		// Nil elements are skipped.
+		var rows []reflect.Value
+		for i := 0; i < v.Len(); i++ {
+			if row := indirect(v.Index(i)); row.IsValid() {
+				rows = append(rows, row)
+			}
+		}
+		if elemType.Kind() == reflect.Interface {
+			// The rows must all hold the same type.
+			if len(rows) == 0 {
+				return nil, false
+			}
+			elemType = rows[0].Type()
+			for _, row := range rows {
+				if row.Type() != elemType {
+					return nil, false
+				}
+			}
+		}
+		if elemType.Kind() != reflect.Struct && elemType.Kind() != reflect.Map {
+			return nil, false
+		}
+		return tabulateRows(rows, elemType)
+	}
+	return nil, false
+}
+
+// tabulateRows returns the table for rows, which are non-nil structs or
+// maps of type t.
+func tabulateRows(rows []reflect.Value, t reflect.Type) (*table, bool) {
+	result := &table{}
+	if t.Kind() == reflect.Struct {
+		var fields []int
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			header := fieldHeader(field)
+			if header == "-" {
+				continue
+			}
+			fields = append(fields, i)
+			result.headers = append(result.headers, header)
+		}
+		for _, row := range rows {
+			cells := make([]string, len(fields))
+			for i, field := range fields {
+				cells[i] = formatCell(row.Field(field))
+			}
+			result.rows = append(result.rows, cells)
+		}
+		return result, true
+	}
+	keys := make(map[string]bool)
+	for _, row := range rows {
+		for _, key := range row.MapKeys() {
+			keys[fmt.Sprint(key.Interface())] = true
+		}
+	}
+	for key := range keys {
+		result.headers = append(result.headers, key)
+	}
+	sort.Strings(result.headers)
+	for _, row := range rows {
+		cells := make([]string, len(result.headers))
+		values := make(map[string]reflect.Value)
+		for _, key := range row.MapKeys() {
+			values[fmt.Sprint(key.Interface())] = row.MapIndex(key)
+		}
+		for i, header := range result.headers {
+			if value, ok := values[header]; ok {
+				cells[i] = formatCell(value)
+			}
+		}
+		result.rows = append(result.rows, cells)
+	}
+	return result, true
+}
+
+// selectColumns returns a table holding the named columns of t.
+func (t *table) selectColumns(columns []string) (*table, error) {
+	indexes := make([]int, len(columns))
+	for i, column := range columns {
+		indexes[i] = -1
+		for j, header := range t.headers {
+			if strings.EqualFold(column, header) {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] == -1 {
+			return nil, fmt.Errorf("unknown column %q (valid columns: %s)", column, strings.Join(t.headers, ", "))
+		}
+	}
+	result := &table{}
+	for _, i := range indexes {
+		result.headers = append(result.headers, t.headers[i])
+	}
+	for _, row := range t.rows {
+		cells := make([]string, len(indexes))
+		for i, j := range indexes {
+			cells[i] = row[j]
+		}
+		result.rows = append(result.rows, cells)
+	}
+	return result, nil
+}
+
+// fieldHeader returns the header for a struct field.
+func fieldHeader(field reflect.StructField) string {
+	for _, key := range []string{"tabular", "yaml", "json"} {
+		tag := field.Tag.Get(key)
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// formatCell returns the text for a single cell.
+func formatCell(v reflect.Value) string {
+	v = indirect(v)
+	if !v.IsValid() {
+		return ""
+	}
+	var s string
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = formatCell(v.Index(i))
+		}
+		s = strings.Join(items, ",")
+	default:
+		s = fmt.Sprint(v.Interface())
+	}
+	// Tabs and newlines would break the alignment of the columns.
+	return strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return ' '
+		}
+		return r
+	}, s)
+}
+
+// indirect follows pointers and interfaces from v, returning the zero
+// Value if a nil is found.
+func indirect(v reflect.Value) reflect.Value {
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return reflect.Value{}
+		}
+		v = v.Elem()
+	}
+	return v
+}
@@ -8,7 +8,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"path/filepath"
 
+	gc "gopkg.in/check.v1"
 	"launchpad.net/gnuflag"
 
 	"github.com/juju/cmd"
@@ -18,13 +21,88 @@ func bufferString(stream io.Writer) string {
 	return stream.(*bytes.Buffer).String()
 }
 
+// runMain runs command with Main in ctx, with env added to its
+// environment, and returns the exit code and the output written.
+func runMain(ctx *cmd.Context, command cmd.Command, env map[string]string, args ...string) (int, string, string) {
+	for key, value := range env {
+		ctx.Setenv(key, value)
+	}
+	code := cmd.Main(command, ctx, args)
+	return code, bufferString(ctx.Stdout), bufferString(ctx.Stderr)
+}
+
+// writeUserAliases writes content to a new user aliases file, and
+// returns its name.
+func writeUserAliases(c *gc.C, content string) string {
+	filename := filepath.Join(c.MkDir(), "aliases")
+	err := ioutil.WriteFile(filename, []byte(content), 0644)
+	c.Assert(err, gc.IsNil)
+	return filename
+}
+
+// newTestSuper returns a SuperCommand made with params, holding the
+// commands that the tests of generated documentation, completion and
+// suggestions describe: defenestrate, which is also known as defen,
+// throw and the deprecated old-throw; the nested SuperCommand bar,
+// whose foo subcommand is also known as bar-foo; the deprecated old;
+// and the help topic concepts.
+func newTestSuper(params cmd.SuperCommandParams) *cmd.SuperCommand {
+	sc := cmd.NewSuperCommand(params)
+	sc.Register(&TestCommand{Name: "defenestrate", Aliases: []string{"defen"}})
+	sc.RegisterDeprecated(&simple{name: "old"}, deprecate{replacement: "defenestrate"})
+	sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:        "bar",
+		UsagePrefix: params.Name,
+		Purpose:     "bar functions",
+	})
+	sub.Register(&simple{name: "foo"})
+	sc.Register(sub)
+	sc.RegisterAlias("throw", "defenestrate", nil)
+	sc.RegisterAlias("old-throw", "defenestrate", deprecate{replacement: "throw"})
+	sc.RegisterSuperAlias("bar-foo", "bar", "foo", nil)
+	sc.AddHelpTopic("concepts", "Basic concepts", "Try jujutest defenestrate.\n\nSee also:\n    defenestrate\n    topics", "concept")
+	return sc
+}
+
+// aliasedParams returns the parameters of a SuperCommand with the user
+// alias def, and shell completion enabled.
+func aliasedParams(c *gc.C) cmd.SuperCommandParams {
+	return cmd.SuperCommandParams{
+		Name:                "jujutest",
+		Purpose:             "test completion",
+		Log:                 &cmd.Log{},
+		UserAliasesFilename: writeUserAliases(c, "def = defenestrate --option firmly\n"),
+		Completion:          true,
+	}
+}
+
+// newEnvSuper returns a SuperCommand made with params, holding the
+// commands that the tests of flags set from the environment and from
+// configuration files run: env, which binds its flags as flagEnv says,
+// blah, and the nested SuperCommand sub, which holds its own blah and
+// other.
+func newEnvSuper(params cmd.SuperCommandParams, flagEnv map[string]string) *cmd.SuperCommand {
+	super := cmd.NewSuperCommand(params)
+	super.Register(&envCommand{flagEnv: flagEnv})
+	super.Register(&TestCommand{Name: "blah"})
+	sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:        "sub",
+		UsagePrefix: params.Name,
+	})
+	sub.Register(&TestCommand{Name: "blah"})
+	sub.Register(&TestCommand{Name: "other"})
+	super.Register(sub)
+	return super
+}
+
 // TestCommand is used by several different tests.
 type TestCommand struct {
 	cmd.CommandBase
-	Name    string
-	Option  string
-	Minimal bool
-	Aliases []string
+	Name     string
+	Option   string
+	Minimal  bool
+	Aliases  []string
+	Category string
 }
 
 func (c *TestCommand) Info() *cmd.Info {
@@ -32,11 +110,12 @@ func (c *TestCommand) Info() *cmd.Info {
 		return &cmd.Info{Name: c.Name}
 	}
 	return &cmd.Info{
-		Name:    c.Name,
-		Args:    "<something>",
-		Purpose: c.Name + " the juju",
-		Doc:     c.Name + "-doc",
-		Aliases: c.Aliases,
+		Name:     c.Name,
+		Args:     "<something>",
+		Purpose:  c.Name + " the juju",
+		Doc:      c.Name + "-doc",
+		Aliases:  c.Aliases,
+		Category: c.Category,
 	}
 }
 
@@ -89,3 +168,18 @@ Options:
 Details:
 verb-doc
 `
+
+// newFailingSuper returns a SuperCommand made with params, holding a
+// fail command, and the nested SuperCommand bar, which holds another.
+// Both commands return runErr from Run.
+func newFailingSuper(params cmd.SuperCommandParams, runErr error) *cmd.SuperCommand {
+	sc := cmd.NewSuperCommand(params)
+	sc.Register(&failingCommand{runErr: runErr})
+	sub := cmd.NewSuperCommand(cmd.SuperCommandParams{
+		Name:        "bar",
+		UsagePrefix: params.Name,
+	})
+	sub.Register(&failingCommand{runErr: runErr})
+	sc.Register(sub)
+	return sc
+}